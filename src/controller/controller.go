@@ -1,17 +1,26 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"log"
 	"fmt"
-	"strconv"
+	"os"
+	"strings"
+	"sync"
+	"time"
 	"github.com/KevinJGard/MusicDB/src/model"
 )
 
-// Controller manages the interaction between the model and the view.
+// Controller manages the interaction between the model and the view. Mining, applying the
+// changes seen by the watcher and previewing inferred tags run one at a time, since they all
+// configure and use the miner.
 type Controller struct {
 	DB *model.DataBase
 	Miner *model.Miner
 	Config *model.Config
+	Covers *model.CoverCache
+	mining sync.Mutex
 }
 
 // NewController creates and returns a new Controller instance.
@@ -19,7 +28,7 @@ func NewController() *Controller {
 	config := model.NewConfig()
 	db := model.NewDataBase()
 	miner := model.NewMiner()
-	return &Controller{DB: db, Miner: miner, Config: config}
+	return &Controller{DB: db, Miner: miner, Config: config, Covers: model.NewCoverCache()}
 }
 
 // SetMusicDirectory updates the music directory in the configuration.
@@ -27,58 +36,497 @@ func (c *Controller) SetMusicDirectory(newDir string) error {
 	return c.Config.SetDirectory(newDir)
 }
 
-// MineMetadata finds MP3 files in the directory, extracts metadata from an MP3 file and 
-// inserts it into the database.
-func (c *Controller) MineMetadata(updateProgress func(int), complete func()) error {
-	directory := c.Config.MusicDirectory
-	files, err := c.Miner.FindMP3Files(directory)
+// minedFile holds the metadata and content hash parsed from a file by a mining worker.
+// Skipped is set when the file did not change since it was last mined.
+type minedFile struct {
+	file string
+	info os.FileInfo
+	hash string
+	metadata model.TrackMetadata
+	skipped bool
+	err error
+}
+
+// MineMetadata mines the audio files of the music directory into the database, skipping
+// those unchanged since the last mining and flagging the songs whose file is gone as missing.
+// Failed files do not stop the mining; the returned report lists them and is saved as the
+// last scan report, even when the mining fails or the context is cancelled.
+func (c *Controller) MineMetadata(ctx context.Context, updateProgress func(int), complete func()) (model.ScanReport, error) {
+	report := model.ScanReport{Directory: c.Config.MusicDirectory, Started: time.Now()}
+	err := c.mine(ctx, &report, updateProgress)
+	report.Elapsed = time.Since(report.Started)
+	report.Cancelled = ctx.Err() != nil
+	if err != nil && !report.Cancelled {
+		report.Error = err.Error()
+	}
+	if saveErr := c.DB.SaveScanReport(report); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err == nil {
+		complete()
+	}
+	return report, err
+}
+
+// mine runs the mining described by MineMetadata, counting what happens to each file in the
+// report. The songs are first regrouped with the configured album identity. The configured
+// workers parse the files in parallel, and each batch of results is stored in one short
+// transaction. When the context is cancelled, the files stored so far are kept and its error
+// is returned; otherwise the library is pruned as configured and the albums whose songs
+// changed get their covers.
+func (c *Controller) mine(ctx context.Context, report *model.ScanReport, updateProgress func(int)) error {
+	c.mining.Lock()
+	defer c.mining.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := c.configureMiner(); err != nil {
+		return err
+	}
+	albums := make(map[int64]bool)
+	regrouped, err := c.DB.RegroupAlbums(c.Miner.AlbumIdentity)
+	if err != nil {
+		return err
+	}
+	for _, id := range regrouped {
+		albums[id] = true
+	}
+
+	files, err := c.Miner.FindAudioFiles(report.Directory)
 	if err != nil {
 		return err
 	}
 
+	states, err := c.DB.GetFileStates()
+	if err != nil {
+		return err
+	}
+	if report.Missing, err = c.markMissingFiles(files, states); err != nil {
+		return err
+	}
+
+	jobs := make(chan string)
+	results := make(chan minedFile)
+	var workers sync.WaitGroup
+	defer func() {
+		cancel()
+		workers.Wait()
+	}()
+	for i := 0; i < c.Config.WorkerCount(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for file := range jobs {
+				result := c.mineFile(file, states)
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, file := range files {
+			select {
+			case jobs <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
 	totalFiles := len(files)
-	for i, file := range files {
-		if err := c.Miner.ProcessFile(c.DB, file); err != nil {
-			log.Printf("Error procesing file %s: %v", file, err)
-			continue
+	batchSize := c.Config.MiningBatchSize()
+	var pending []minedFile
+	received := 0
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.storeFiles(pending, states, report, albums); err != nil {
+				return err
+			}
+			return ctx.Err()
+		case result, ok := <-results:
+			if !ok {
+				if err := c.storeFiles(pending, states, report, albums); err != nil {
+					return err
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := c.pruneLibrary(); err != nil {
+					return err
+				}
+				return c.updateAlbumCovers(report, albums)
+			}
+			pending = append(pending, result)
+			if len(pending) == batchSize {
+				if err := c.storeFiles(pending, states, report, albums); err != nil {
+					return err
+				}
+				pending = nil
+			}
+			received++
+			updateProgress(received * 100 / totalFiles)
 		}
-		updateProgress((i + 1) * 100 / totalFiles)
 	}
-	complete()
+}
+
+// LastScanReport returns the report of the last mining. It reports false when the library
+// was never mined.
+func (c *Controller) LastScanReport() (model.ScanReport, bool, error) {
+	return c.DB.GetLastScanReport()
+}
+
+// configureMiner makes the miner group albums with the configured strategy, infer tags
+// with the configured filename patterns, split artists on the configured separators and
+// store the embedded pictures in the cover cache. It is called holding the mining lock, so
+// it never changes the miner while it is in use.
+func (c *Controller) configureMiner() error {
+	identity := c.Config.AlbumIdentityStrategy()
+	if err := identity.Validate(); err != nil {
+		return err
+	}
+	patterns, mode, err := c.Config.CompilePatterns()
+	if err != nil {
+		return err
+	}
+	c.Miner.AlbumIdentity = identity
+	c.Miner.Patterns, c.Miner.PatternMode = patterns, mode
+	c.Miner.Covers = c.Covers
+	c.Miner.Artists = c.Config.ArtistSplitter()
 	return nil
 }
 
-// GetSongs retrieves all songs from the database.
-func (c *Controller) GetSongs() ([]model.Song, error) {
-	var songs []model.Song
-	rows, err := c.DB.Db.Query("SELECT * FROM rolas")
+// InferredTags are the tags of a file after applying the filename patterns, and the names of
+// the tags that were inferred from its path.
+type InferredTags struct {
+	File string
+	Metadata model.TrackMetadata
+	Inferred []string
+}
+
+// PreviewInferredTags shows what the configured filename patterns infer for each audio file
+// in the directory, without changing the database.
+func (c *Controller) PreviewInferredTags(directory string) ([]InferredTags, error) {
+	c.mining.Lock()
+	defer c.mining.Unlock()
+	if err := c.configureMiner(); err != nil {
+		return nil, err
+	}
+	files, err := c.Miner.FindAudioFiles(directory)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	var previews []InferredTags
+	for _, file := range files {
+		metadata, err := c.Miner.ReadTags(file)
+		if err != nil {
+			log.Printf("Error reading metadata for %s: %v", file, err)
+			continue
+		}
+		preview := InferredTags{File: file}
+		preview.Metadata, preview.Inferred = c.Miner.InferTags(file, metadata)
+		previews = append(previews, preview)
+	}
+	return previews, nil
+}
+
+// mineFile reads the metadata and hash of a file, unless it did not change since it was last
+// mined. It runs in the mining workers, so it does not touch the database.
+func (c *Controller) mineFile(file string, states map[string]model.FileState) minedFile {
+	result := minedFile{file: file}
+	result.info, result.err = os.Stat(file)
+	if result.err != nil {
+		return result
+	}
+	if state, ok := states[file]; ok && state.Matches(result.info) {
+		result.skipped = true
+		return result
+	}
+	result.hash, result.err = model.HashFile(file)
+	if result.err != nil {
+		return result
+	}
+	result.metadata, result.err = c.Miner.MineMetadata(file)
+	// The picture is already in the cover cache, so it is not kept while the file waits to
+	// be stored.
+	result.metadata.Picture = nil
+	return result
+}
+
+// writeBatch runs write with a batch of the database and commits it, so the write lock of
+// the database is only held while the batch is written.
+func (c *Controller) writeBatch(write func(batch *model.DataBase) error) error {
+	batch, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer batch.Rollback()
+	if err := write(batch); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
 
-	for rows.Next() {
-		var song model.Song
-		if err := rows.Scan(&song.ID, &song.PerformerID, &song.AlbumID, &song.Path, &song.Title, &song.Track, &song.Year, &song.Genre); err != nil {
-			return nil, err
+// storeFiles writes the results of the mining workers into the database in one batch,
+// counting in the report what happened to each file and adding to albums the IDs of the
+// albums whose songs changed.
+func (c *Controller) storeFiles(results []minedFile, states map[string]model.FileState, report *model.ScanReport, albums map[int64]bool) error {
+	return c.writeBatch(func(batch *model.DataBase) error {
+		for _, result := range results {
+			report.Scanned++
+			if stored, touched, err := c.storeFile(batch, result, states); err != nil {
+				report.Fail(result.file, err)
+			} else if result.skipped {
+				report.Skipped++
+			} else {
+				report.Count(stored)
+				for _, id := range touched {
+					albums[id] = true
+				}
+			}
+			for _, warning := range result.metadata.Warnings {
+				report.Warn(result.file, warning)
+			}
 		}
+		return nil
+	})
+}
 
-		performerName, err := c.DB.GetPerformerName(song.PerformerID)
+// storeFile writes the result of a mining worker into the batch and returns what it did to the
+// song of the file and the IDs of the albums the song left or joined, nothing for skipped files.
+func (c *Controller) storeFile(batch *model.DataBase, result minedFile, states map[string]model.FileState) (model.StoreResult, []int64, error) {
+	if result.err != nil {
+		return 0, nil, result.err
+	}
+	if result.skipped {
+		if state := states[result.file]; state.Missing {
+			return 0, nil, batch.SetMissing(state.SongID, false)
+		}
+		return 0, nil, nil
+	}
+	return c.Miner.StoreMetadata(batch, result.file, result.info, result.hash, result.metadata)
+}
+
+// markMissingFiles flags in one batch the songs whose file was not found in the music
+// directory and returns how many songs are missing.
+func (c *Controller) markMissingFiles(files []string, states map[string]model.FileState) (int, error) {
+	found := make(map[string]bool, len(files))
+	for _, file := range files {
+		found[file] = true
+	}
+	missing := 0
+	err := c.writeBatch(func(batch *model.DataBase) error {
+		for path, state := range states {
+			if found[path] {
+				continue
+			}
+			missing++
+			if !state.Missing {
+				if err := batch.SetMissing(state.SongID, true); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return missing, nil
+}
+
+// pruneLibrary deletes the songs whose file is missing and the albums and performers left
+// without songs, when the configuration asks for it.
+func (c *Controller) pruneLibrary() error {
+	if c.Config.PruneMissing {
+		if _, err := c.DB.DeleteMissingSongs(); err != nil {
+			return err
+		}
+	}
+	if c.Config.PruneOrphans {
+		if _, err := c.DB.DeleteOrphans(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateAlbumCovers gives each of the albums the picture embedded in its songs as its cover.
+// An album whose songs have none keeps its cover, or else gets the cover picture found in its
+// directory, such as cover.jpg or folder.png. A directory cover that cannot be read is a
+// warning in the report.
+func (c *Controller) updateAlbumCovers(report *model.ScanReport, albums map[int64]bool) error {
+	albumIDs := make([]int64, 0, len(albums))
+	for id := range albums {
+		albumIDs = append(albumIDs, id)
+	}
+	err := c.writeBatch(func(batch *model.DataBase) error {
+		return batch.RefreshAlbumCovers(albumIDs)
+	})
+	if err != nil {
+		return err
+	}
+	uncovered, err := c.DB.GetAlbumsWithoutCover(albumIDs)
+	if err != nil {
+		return err
+	}
+	for _, album := range uncovered {
+		if album.Path == "" {
+			continue
+		}
+		hash, err := c.Covers.StoreDirectoryCover(album.Path)
 		if err != nil {
-			return nil, err
+			report.Warn(album.Path, fmt.Sprintf("reading the cover: %v", err))
+			continue
+		}
+		if hash != "" {
+			if err := c.DB.SetAlbumCover(album.ID, hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Watch keeps the database in sync with the music directory until the context is done. Each
+// batch of changes is applied once the directory stays quiet for the configured delay, and
+// onChange is called after a batch modified the library. The report of each batch is saved
+// as the last scan report. The miner is configured once as the watch starts, and a batch
+// waits for any mining in progress to finish.
+func (c *Controller) Watch(ctx context.Context, onChange func()) error {
+	c.mining.Lock()
+	err := c.configureMiner()
+	c.mining.Unlock()
+	if err != nil {
+		return err
+	}
+	return model.WatchDirectory(ctx, c.Config.MusicDirectory, c.Config.WatchDelayDuration(), func(paths []string) {
+		report := model.ScanReport{Directory: c.Config.MusicDirectory, Started: time.Now()}
+		if err := c.applyChanges(&report, paths); err != nil {
+			log.Printf("Error applying changes: %v", err)
+			report.Error = err.Error()
+		}
+		report.Elapsed = time.Since(report.Started)
+		if err := c.DB.SaveScanReport(report); err != nil {
+			log.Printf("Error saving the scan report: %v", err)
 		}
-		albumName, err := c.DB.GetAlbumName(song.AlbumID)
+		onChange()
+	})
+}
+
+// applyChanges updates the database with a batch of changed paths. Paths that no longer exist
+// are flagged as missing first, so a file renamed within the batch is recognized as moved
+// when its new path is mined. The files are parsed before opening the transactions that
+// store them, each one of the configured batch size, and what happens to each file is
+// counted in the report.
+func (c *Controller) applyChanges(report *model.ScanReport, paths []string) error {
+	c.mining.Lock()
+	defer c.mining.Unlock()
+	var present []string
+	err := c.writeBatch(func(batch *model.DataBase) error {
+		for _, path := range paths {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				missing, err := batch.MarkMissingUnder(path)
+				if err != nil {
+					return err
+				}
+				report.Missing += int(missing)
+			} else {
+				present = append(present, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	states := make(map[string]model.FileState)
+	albums := make(map[int64]bool)
+	var pending []minedFile
+	for _, path := range present {
+		info, err := os.Stat(path)
 		if err != nil {
-			return nil, err
+			report.Fail(path, err)
+			continue
+		}
+		files := []string{path}
+		if info.IsDir() {
+			if files, err = c.Miner.FindAudioFiles(path); err != nil {
+				report.Fail(path, err)
+				continue
+			}
+		} else if !c.Miner.IsAudioFile(path) {
+			continue
+		}
+		for _, file := range files {
+			state, known, err := c.DB.GetFileState(file)
+			if err != nil {
+				return err
+			}
+			if known {
+				states[file] = state
+			}
+			pending = append(pending, c.mineFile(file, states))
 		}
+	}
 
-		song.PerformerName = performerName
-		song.AlbumName = albumName
+	batchSize := c.Config.MiningBatchSize()
+	for start := 0; start < len(pending); start += batchSize {
+		if err := c.storeFiles(pending[start:min(start+batchSize, len(pending))], states, report, albums); err != nil {
+			return err
+		}
+	}
+	if err := c.pruneLibrary(); err != nil {
+		return err
+	}
+	return c.updateAlbumCovers(report, albums)
+}
 
-		songs = append(songs, song)
+// GetSongs retrieves all songs from the database.
+func (c *Controller) GetSongs() ([]model.Song, error) {
+	return c.DB.GetAllSongs()
+}
+
+// CoverThumbnail returns the thumbnail of the picture embedded in a song, or else of its
+// album's cover. It returns an empty path when there is neither.
+func (c *Controller) CoverThumbnail(song model.Song) string {
+	if song.Cover != "" {
+		return c.Covers.ThumbnailPath(song.Cover)
+	}
+	if song.AlbumCover != "" {
+		return c.Covers.ThumbnailPath(song.AlbumCover)
+	}
+	return ""
+}
+
+// ArtistCredit returns every artist of a song as one text, written with the configured
+// separators, such as "Daft Punk feat. Pharrell Williams".
+func (c *Controller) ArtistCredit(song model.Song) string {
+	if song.PerformerName == "" {
+		return ""
 	}
+	primary := append([]string{song.PerformerName}, splitNames(song.Artists)...)
+	return c.Config.ArtistSplitter().Join(primary, splitNames(song.Featured))
+}
 
-	return songs, nil
+// splitNames returns the names of a list separated by semicolons, as the credits of a song
+// are read.
+func splitNames(names string) []string {
+	var split []string
+	for _, name := range strings.Split(names, ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			split = append(split, name)
+		}
+	}
+	return split
 }
 
 // EditSong updates the details of a song.
@@ -87,32 +535,201 @@ func (c *Controller) EditSong(idRola int64, newTitle, newGenre string, newTrack,
 	return err
 }
 
+// WriteSongTags writes the title, artist, album, year, track and genre a song has in the
+// database into the ID3 tag of its file. The file state is updated afterwards, so the next
+// mining does not mine the file again. Only MP3 files can be written.
+func (c *Controller) WriteSongTags(idRola int64) error {
+	song, err := c.DB.GetSong(idRola)
+	if err != nil {
+		return err
+	}
+	return c.writeTags(song)
+}
+
+// WriteAlbumTags writes the tags of every song of an album into their files.
+func (c *Controller) WriteAlbumTags(idAlbum int64) error {
+	songs, err := c.DB.GetAlbumSongs(idAlbum)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, song := range songs {
+		if song.Missing || song.Format != "mp3" {
+			continue
+		}
+		if err := c.writeTags(song); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SyncTagsToFiles writes the tags of every MP3 song in the database into its file, reporting
+// the percentage of songs done. The songs whose file is missing are skipped, and a file that
+// cannot be written does not stop the others: their errors are returned together once every
+// song was tried, with the number of files written.
+func (c *Controller) SyncTagsToFiles(ctx context.Context, updateProgress func(int)) (int, error) {
+	songs, err := c.DB.GetAllSongs()
+	if err != nil {
+		return 0, err
+	}
+	written := 0
+	var errs []error
+	for i, song := range songs {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		if !song.Missing && song.Format == "mp3" {
+			if err := c.writeTags(song); err != nil {
+				errs = append(errs, err)
+			} else {
+				written++
+			}
+		}
+		updateProgress((i + 1) * 100 / len(songs))
+	}
+	return written, errors.Join(errs...)
+}
+
+// writeTags writes the tags of a song into its file and records the new file state.
+func (c *Controller) writeTags(song model.Song) error {
+	if song.Format != "mp3" {
+		return fmt.Errorf("cannot write tags to %s: only MP3 files are supported", song.Path)
+	}
+	tags := model.ID3Tags{
+		Title: song.Title,
+		Artist: c.ArtistCredit(song),
+		Album: song.AlbumName,
+		Year: song.Year,
+		Track: song.Track,
+		Genre: song.Genre,
+	}
+	if err := model.WriteID3Tags(song.Path, tags, c.Config.ID3TagVersion()); err != nil {
+		return fmt.Errorf("writing tags to %s: %v", song.Path, err)
+	}
+	info, err := os.Stat(song.Path)
+	if err != nil {
+		return err
+	}
+	hash, err := model.HashFile(song.Path)
+	if err != nil {
+		return err
+	}
+	return c.DB.SetFileState(song.ID, info, hash)
+}
+
+// EditSongCredits updates the disc number, composers and comment of a song. Several
+// composers are separated by semicolons, and an empty text clears them.
+func (c *Controller) EditSongCredits(idRola int64, disc int, composers, comment string) error {
+	if err := c.DB.UpdateSongDetails(idRola, disc, comment); err != nil {
+		return err
+	}
+	var composerIDs []int64
+	for _, name := range splitNames(composers) {
+		id, err := c.DB.InsertPerformerIfNotExists(name, 0)
+		if err != nil {
+			return err
+		}
+		composerIDs = append(composerIDs, id)
+	}
+	return c.DB.SetCredits(idRola, model.RoleComposer, composerIDs)
+}
+
 // EditAlbum updates the details of an album.
 func (c *Controller) EditAlbum(idAlbum int64, newName string, newYear int) error {
 	err := c.DB.UpdateAlbum(idAlbum, newName, newYear)
 	return err
 }
 
-// DefPerson defines a performer as a person and inserts their details into the database.
+// EditAlbumArtist credits a performer, added if it does not exist, as the artist of an
+// album. An empty name clears it.
+func (c *Controller) EditAlbumArtist(idAlbum int64, name string) error {
+	var performerID int64
+	if name = strings.TrimSpace(name); name != "" {
+		var err error
+		if performerID, err = c.DB.InsertPerformerIfNotExists(name, 0); err != nil {
+			return err
+		}
+	}
+	return c.DB.SetAlbumArtist(idAlbum, performerID)
+}
+
+// DefPerson defines a performer as a person with the given details. A performer already
+// defined as a person keeps it and has its details updated; otherwise it is linked to the
+// person with these details, added if it does not exist.
 func (c *Controller) DefPerson(idPerf int64, stageName, realName, birthDate, deathDate string) error {
 	err := c.DB.UpdatePerformer(idPerf, 0, stageName)
 	if err != nil {
 		return err
 	}
 
-	_, err = c.DB.InsertPersonIfNotExists(stageName, realName, birthDate, deathDate)
-	return err
+	person := model.Person{StageName: stageName, RealName: realName, BirthDate: birthDate, DeathDate: deathDate}
+	current, ok, err := c.DB.GetPersonByPerformer(idPerf)
+	if err != nil {
+		return err
+	}
+	if ok {
+		person.ID = current.ID
+		return c.DB.UpdatePerson(&person)
+	}
+	personID, err := c.DB.InsertPersonIfNotExists(stageName, realName, birthDate, deathDate)
+	if err != nil {
+		return err
+	}
+	return c.DB.LinkPerson(idPerf, personID)
 }
 
-// DefGroup defines a performer as a group and inserts their details into the database.
+// DefGroup defines a performer as a group with the given details. A performer already defined
+// as a group keeps it and has its details updated; otherwise it is linked to the group with
+// these details, added if it does not exist.
 func (c *Controller) DefGroup(idPerf int64, name, startDate, endDate string) error {
 	err := c.DB.UpdatePerformer(idPerf, 1, name)
 	if err != nil {
 		return err
 	}
 
-	_, err = c.DB.InsertGroupIfNotExists(name, startDate, endDate)
-	return err
+	group := model.Group{Name: name, StartDate: startDate, EndDate: endDate}
+	current, ok, err := c.DB.GetGroupByPerformer(idPerf)
+	if err != nil {
+		return err
+	}
+	if ok {
+		group.ID = current.ID
+		return c.DB.UpdateGroup(&group)
+	}
+	groupID, err := c.DB.InsertGroupIfNotExists(name, startDate, endDate)
+	if err != nil {
+		return err
+	}
+	return c.DB.LinkGroup(idPerf, groupID)
+}
+
+// GetPerformerDetails returns a performer with the person or group it is defined as and, for
+// a person, the groups it is a member of.
+func (c *Controller) GetPerformerDetails(idPerf int64) (model.PerformerDetails, error) {
+	performer, err := c.DB.GetPerformer(idPerf)
+	if err != nil {
+		return model.PerformerDetails{}, err
+	}
+	details := model.PerformerDetails{Performer: performer}
+	person, ok, err := c.DB.GetPersonByPerformer(idPerf)
+	if err != nil {
+		return details, err
+	}
+	if ok {
+		details.Person = &person
+		if details.Groups, err = c.DB.GetGroupsOfPerson(person.ID); err != nil {
+			return details, err
+		}
+	}
+	group, ok, err := c.DB.GetGroupByPerformer(idPerf)
+	if err != nil {
+		return details, err
+	}
+	if ok {
+		details.Group = &group
+	}
+	return details, nil
 }
 
 // EditPerf updates the name of a performer
@@ -121,77 +738,117 @@ func (c *Controller) EditPerf(idPerf int64, newName string) error {
 	return err
 }
 
-// AddPersonToGroup adds a person to a specified group in the database.
-func (c *Controller) AddPersonToGroup(stageName, realName, birthDate, deathDate, nameGroup string) error {
-	personID, err := c.DB.GetPersonID(stageName, realName, birthDate, deathDate)
-	if err != nil {
-		return err
-	}
-	groupID, err := c.DB.GetGroupIDByName(nameGroup)
-	if err != nil {
-		return err
+// FindDuplicatePerformers returns the groups of performers that are likely the same one,
+// the one with most songs first as the suggested survivor.
+func (c *Controller) FindDuplicatePerformers() ([]model.Duplicates, error) {
+	return c.DB.FindDuplicatePerformers()
+}
+
+// FindDuplicateAlbums returns the groups of albums that are likely the same one, the one with
+// most songs first as the suggested survivor.
+func (c *Controller) FindDuplicateAlbums() ([]model.Duplicates, error) {
+	return c.DB.FindDuplicateAlbums()
+}
+
+// MergePerformers moves everything of the duplicate performers to the surviving one and
+// deletes them.
+func (c *Controller) MergePerformers(idSurvivor int64, idDuplicates []int64) error {
+	if len(idDuplicates) == 0 {
+		return fmt.Errorf("pick the performers to merge.")
 	}
+	return c.DB.MergePerformers(idSurvivor, idDuplicates)
+}
 
-	if groupID == 0 {
-		return fmt.Errorf("the group '%s' is not found in the database.", nameGroup)
+// MergeAlbums moves the songs of the duplicate albums to the surviving one and deletes them.
+func (c *Controller) MergeAlbums(idSurvivor int64, idDuplicates []int64) error {
+	if len(idDuplicates) == 0 {
+		return fmt.Errorf("pick the albums to merge.")
 	}
-	
-	return c.DB.InsertPersonInGroup(personID, groupID)
+	return c.DB.MergeAlbums(idSurvivor, idDuplicates)
 }
 
-// GetSearchSongs searches for songs according to the request.
-func (c *Controller) GetSearchSongs(search string) ([]model.Song, error) {
-	results := splitString(search)
+// GetPersons returns every person, to pick the members of a group from.
+func (c *Controller) GetPersons() ([]model.Person, error) {
+	return c.DB.GetPersons()
+}
 
-	var allSongs []model.Song
-	if len(results["titles"]) > 0 {
-		for _, title := range results["titles"] {
-			songsByTitle, err := c.DB.SearchByTitle(title)
-			if err != nil {
-				return nil, err
-			}
-			allSongs = append(allSongs, songsByTitle...)
-		}
+// GetGroups returns every group.
+func (c *Controller) GetGroups() ([]model.Group, error) {
+	return c.DB.GetGroups()
+}
+
+// GetGroupMembers returns the persons that are or were members of a group.
+func (c *Controller) GetGroupMembers(idGroup int64) ([]model.Membership, error) {
+	return c.DB.GetGroupMembers(idGroup)
+}
+
+// GetPersonMemberships returns the groups a person is or was a member of.
+func (c *Controller) GetPersonMemberships(idPerson int64) ([]model.Membership, error) {
+	return c.DB.GetPersonMemberships(idPerson)
+}
+
+// AddMember adds a person to a group with the dates they joined and left it and their role,
+// each of them optional. A person already in the group has them updated.
+func (c *Controller) AddMember(idPerson, idGroup int64, startDate, endDate, role string) error {
+	if idPerson == 0 || idGroup == 0 {
+		return fmt.Errorf("pick a person and a group.")
 	}
-	if len(results["artists"]) > 0 {
-		for _, artist := range results["artists"] {
-			songsByPerformer, err := c.DB.SearchByPerformer(artist)
-			if err != nil {
-				return nil, err
-			}
-			allSongs = append(allSongs, songsByPerformer...)
-		}
+	return c.DB.AddMember(model.Membership{
+		PersonID: idPerson,
+		GroupID: idGroup,
+		StartDate: strings.TrimSpace(startDate),
+		EndDate: strings.TrimSpace(endDate),
+		Role: strings.TrimSpace(role),
+	})
+}
+
+// RemoveMember removes a person from a group.
+func (c *Controller) RemoveMember(idPerson, idGroup int64) error {
+	return c.DB.RemoveMember(idPerson, idGroup)
+}
+
+// GetSearchSongs searches for songs according to the request, written in the search language,
+// returning the page of results described by the options.
+// A malformed request returns a *QueryError with the position of the problem.
+func (c *Controller) GetSearchSongs(search string, options model.SearchOptions) ([]model.Song, error) {
+	filter, err := BuildSearchFilter(c.DB, search)
+	if err != nil {
+		return nil, err
 	}
-	if len(results["albums"]) > 0 {
-		for _, album := range results["albums"] {
-			songsByAlbum, err := c.DB.SearchByAlbum(album)
-			if err != nil {
-				return nil, err
-			}
-			allSongs = append(allSongs, songsByAlbum...)
-		}
+	return c.DB.FilterSongs(filter, options)
+}
+
+// CountSearchSongs returns how many songs match the request.
+func (c *Controller) CountSearchSongs(search string) (int, error) {
+	filter, err := BuildSearchFilter(c.DB, search)
+	if err != nil {
+		return 0, err
 	}
-	if len(results["years"]) > 0 {
-		for _, year := range results["years"] {
-			yearNum, err := strconv.Atoi(year)
-			if err != nil {
-				return nil, err
-			}
-			songsByYear, err := c.DB.SearchByYear(yearNum)
-			if err != nil {
-				return nil, err
-			}
-			allSongs = append(allSongs, songsByYear...)
-		}
+	return c.DB.CountSongs(filter)
+}
+
+// MissingMetadata is the number of songs without a value in a field, and the search that
+// lists them.
+type MissingMetadata struct {
+	Field model.SearchField
+	Search string
+	Count int
+}
+
+// MissingMetadataReport counts the songs missing each main field, starting with the songs
+// missing any of them, so untagged files can be found and fixed.
+func (c *Controller) MissingMetadataReport() ([]MissingMetadata, error) {
+	counts, err := c.DB.CountMissing()
+	if err != nil {
+		return nil, err
 	}
-	if len(results["genres"]) > 0 {
-		for _, genre := range results["genres"] {
-			songsByGenre, err := c.DB.SearchByGenre(genre)
-			if err != nil {
-				return nil, err
+	report := []MissingMetadata{{model.FieldAny, "mi:any", counts[model.FieldAny]}}
+	for _, field := range model.MissingFields {
+		for prefix, prefixField := range searchFields {
+			if prefixField == field {
+				report = append(report, MissingMetadata{field, "mi:" + prefix, counts[field]})
 			}
-			allSongs = append(allSongs, songsByGenre...)
 		}
 	}
-	return allSongs, nil
-}
\ No newline at end of file
+	return report, nil
+}
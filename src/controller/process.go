@@ -1,38 +1,440 @@
 package controller
 
-import "strings"
-
-// addValues appends values from the given section to the results map under the specified key.
-func addValues(results map[string][]string, key, seccion string) {
-	values := strings.Split(seccion, "&&")
-	results[key] = append(results[key], values...)
-}
-
-// splitString processes the search string and separates its content into titles, artists, 
-// albums, years and genres, according to the set search language.
-func splitString(search string) map[string][]string {
-	results := map[string][]string{
-		"titles": {},
-		"artists": {},
-		"albums": {},
-		"years": {},
-		"genres": {},
-	}
-
-	sections := strings.Split(search, "||")
-
-	for _, seccion := range sections {
-		if strings.HasPrefix(seccion, "ti:") {
-			addValues(results, "titles", strings.TrimPrefix(seccion, "ti:"))
-		} else if strings.HasPrefix(seccion, "ar:") {
-			addValues(results, "artists", strings.TrimPrefix(seccion, "ar:"))
-		} else if strings.HasPrefix(seccion, "al:") {
-			addValues(results, "albums", strings.TrimPrefix(seccion, "al:"))
-		} else if strings.HasPrefix(seccion, "ye:") {
-			addValues(results, "years", strings.TrimPrefix(seccion, "ye:"))
-		} else if strings.HasPrefix(seccion, "ge:") {
-			addValues(results, "genres", strings.TrimPrefix(seccion, "ge:"))
-		}
-	}
-	return results
-}
\ No newline at end of file
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"github.com/KevinJGard/MusicDB/src/model"
+)
+
+// searchFields maps the prefixes of the search language to the fields they filter.
+var searchFields = map[string]model.SearchField{
+	"ti": model.FieldTitle,
+	"ar": model.FieldPerformer,
+	"al": model.FieldAlbum,
+	"ye": model.FieldYear,
+	"ge": model.FieldGenre,
+	"tr": model.FieldTrack,
+	"fo": model.FieldFormat,
+	"aa": model.FieldAlbumArtist,
+	"co": model.FieldComposer,
+	"cm": model.FieldComment,
+	"di": model.FieldDisc,
+	"mi": model.FieldMissing,
+}
+
+// QueryError reports a malformed search and the position, counted in characters from 1,
+// where the problem was found.
+type QueryError struct {
+	Position int
+	Message  string
+}
+
+// Error formats the error with its position.
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("search error at position %d: %s", e.Position, e.Message)
+}
+
+// tokenKind identifies the kind of a token of the search language.
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenPhrase
+	tokenField
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+// token is a lexical unit of the search with its position.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// isSeparator reports whether the rune at i ends a word.
+func isSeparator(runes []rune, i int) bool {
+	r := runes[i]
+	if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+		return true
+	}
+	return i+1 < len(runes) && ((r == '&' && runes[i+1] == '&') || (r == '|' && runes[i+1] == '|'))
+}
+
+// tokenize splits the search into words, quoted phrases, field prefixes, operators and parentheses.
+func tokenize(search string) ([]token, error) {
+	runes := []rune(search)
+	var tokens []token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenOpen, "(", pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenClose, ")", pos})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &QueryError{pos, "unterminated quoted phrase"}
+			}
+			phrase := strings.TrimSpace(string(runes[i+1 : end]))
+			if phrase == "" {
+				return nil, &QueryError{pos, "empty quoted phrase"}
+			}
+			tokens = append(tokens, token{tokenPhrase, phrase, pos})
+			i = end + 1
+		case isSeparator(runes, i):
+			if r == '&' {
+				tokens = append(tokens, token{tokenAnd, "&&", pos})
+			} else {
+				tokens = append(tokens, token{tokenOr, "||", pos})
+			}
+			i += 2
+		case r == '!' || (r == '-' && i+1 < len(runes) && !isSeparator(runes, i+1)):
+			tokens = append(tokens, token{tokenNot, string(r), pos})
+			i++
+		default:
+			end := i
+			for end < len(runes) && unicode.IsLetter(runes[end]) {
+				end++
+			}
+			if end > i && end < len(runes) && runes[end] == ':' {
+				name := string(runes[i:end])
+				if _, ok := searchFields[name]; !ok {
+					return nil, &QueryError{pos, fmt.Sprintf("unknown field '%s:'", name)}
+				}
+				tokens = append(tokens, token{tokenField, name, pos})
+				i = end + 1
+				continue
+			}
+			for end < len(runes) && !isSeparator(runes, end) {
+				end++
+			}
+			word := string(runes[i:end])
+			switch word {
+			case "AND":
+				tokens = append(tokens, token{tokenAnd, word, pos})
+			case "OR":
+				tokens = append(tokens, token{tokenOr, word, pos})
+			case "NOT":
+				tokens = append(tokens, token{tokenNot, word, pos})
+			default:
+				tokens = append(tokens, token{tokenWord, word, pos})
+			}
+			i = end
+		}
+	}
+	return append(tokens, token{tokenEnd, "", len(runes) + 1}), nil
+}
+
+// queryNode is a node of the syntax tree of a search.
+type queryNode interface{}
+
+// andNode matches the songs matched by both of its operands.
+type andNode struct {
+	left, right queryNode
+}
+
+// orNode matches the songs matched by any of its operands.
+type orNode struct {
+	left, right queryNode
+}
+
+// notNode matches the songs not matched by its operand.
+type notNode struct {
+	operand queryNode
+}
+
+// termNode matches a word or a quoted phrase, in one field or in any of them.
+type termNode struct {
+	field  model.SearchField
+	prefix string
+	text   string
+	phrase bool
+	pos    int
+}
+
+// queryParser builds the syntax tree of a search by recursive descent over its tokens.
+// The grammar, from lowest to highest precedence, is:
+//
+//	or      = and { ("OR" | "||") and }
+//	and     = not { ["AND" | "&&"] not }
+//	not     = ("NOT" | "!" | "-") not | primary
+//	primary = "(" or ")" | [field ":"] (word | phrase | "(" or ")")
+type queryParser struct {
+	tokens []token
+	pos    int
+	prefix string
+}
+
+// peek returns the current token without consuming it.
+func (p *queryParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the current token.
+func (p *queryParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEnd {
+		p.pos++
+	}
+	return tok
+}
+
+// parseOr parses a sequence of alternatives.
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd parses a sequence of terms joined by AND, explicitly or by juxtaposition.
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.next()
+		case tokenWord, tokenPhrase, tokenField, tokenNot, tokenOpen:
+		default:
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+}
+
+// parseNot parses an optionally negated term.
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses a word, a phrase, a field prefix or a parenthesized group.
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenWord, tokenPhrase:
+		return &termNode{searchFields[p.prefix], p.prefix, tok.text, tok.kind == tokenPhrase, tok.pos}, nil
+	case tokenOpen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenClose {
+			return nil, &QueryError{tok.pos, "missing closing parenthesis"}
+		}
+		return node, nil
+	case tokenField:
+		if p.prefix != "" {
+			return nil, &QueryError{tok.pos, fmt.Sprintf("field '%s:' inside field '%s:'", tok.text, p.prefix)}
+		}
+		switch p.peek().kind {
+		case tokenWord, tokenPhrase, tokenOpen:
+		default:
+			return nil, &QueryError{tok.pos, fmt.Sprintf("field '%s:' without a value", tok.text)}
+		}
+		p.prefix = tok.text
+		node, err := p.parsePrimary()
+		p.prefix = ""
+		return node, err
+	case tokenEnd:
+		return nil, &QueryError{tok.pos, "unexpected end of search"}
+	default:
+		return nil, &QueryError{tok.pos, fmt.Sprintf("unexpected '%s'", tok.text)}
+	}
+}
+
+// parseQuery parses a search into its syntax tree.
+func parseQuery(search string) (queryNode, error) {
+	tokens, err := tokenize(search)
+	if err != nil {
+		return nil, err
+	}
+	parser := &queryParser{tokens: tokens}
+	if parser.peek().kind == tokenEnd {
+		return nil, &QueryError{1, "empty search"}
+	}
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := parser.peek(); tok.kind != tokenEnd {
+		return nil, &QueryError{tok.pos, fmt.Sprintf("unexpected '%s'", tok.text)}
+	}
+	return node, nil
+}
+
+// compileQuery translates a syntax tree into a single parameterized filter over the songs.
+func compileQuery(db *model.DataBase, node queryNode) (model.SongFilter, error) {
+	switch n := node.(type) {
+	case *andNode:
+		left, right, err := compileOperands(db, n.left, n.right)
+		if err != nil {
+			return model.SongFilter{}, err
+		}
+		return model.AndFilters(left, right), nil
+	case *orNode:
+		left, right, err := compileOperands(db, n.left, n.right)
+		if err != nil {
+			return model.SongFilter{}, err
+		}
+		return model.OrFilters(left, right), nil
+	case *notNode:
+		operand, err := compileQuery(db, n.operand)
+		if err != nil {
+			return model.SongFilter{}, err
+		}
+		return model.NotFilter(operand), nil
+	case *termNode:
+		return compileTerm(db, n)
+	}
+	return model.SongFilter{}, fmt.Errorf("unknown search node %T", node)
+}
+
+// compileOperands compiles both operands of a binary node.
+func compileOperands(db *model.DataBase, left, right queryNode) (model.SongFilter, model.SongFilter, error) {
+	leftFilter, err := compileQuery(db, left)
+	if err != nil {
+		return model.SongFilter{}, model.SongFilter{}, err
+	}
+	rightFilter, err := compileQuery(db, right)
+	return leftFilter, rightFilter, err
+}
+
+// compileTerm translates a single term into a filter on its field.
+func compileTerm(db *model.DataBase, term *termNode) (model.SongFilter, error) {
+	if term.field == model.FieldMissing {
+		return compileMissingTerm(db, term)
+	}
+	if term.field.IsNumeric() {
+		return compileNumberTerm(db, term)
+	}
+	return db.TextFilter(term.field, term.text, term.phrase)
+}
+
+// compileMissingTerm translates a term such as 'mi:ye', matching the songs without a value
+// in the field of the given prefix, or 'mi:any', matching those missing any main field.
+func compileMissingTerm(db *model.DataBase, term *termNode) (model.SongFilter, error) {
+	name := strings.ToLower(term.text)
+	field, ok := searchFields[name]
+	if name == "any" {
+		field, ok = model.FieldAny, true
+	}
+	if !ok || field == model.FieldMissing || term.phrase {
+		return model.SongFilter{}, &QueryError{term.pos, fmt.Sprintf("'%s:' expects a field prefix or 'any', found '%s'", term.prefix, term.text)}
+	}
+	filter, err := db.MissingFilter(field)
+	if err != nil {
+		return model.SongFilter{}, &QueryError{term.pos, err.Error()}
+	}
+	return filter, nil
+}
+
+// numberOperators lists the comparisons accepted before a number, longest first.
+var numberOperators = []string{">=", "<=", ">", "<", "="}
+
+// compileNumberTerm translates a term on an integer field: a number, a comparison such as
+// '>=2000' or an inclusive range such as '1980..1989', where either end may be left open.
+func compileNumberTerm(db *model.DataBase, term *termNode) (model.SongFilter, error) {
+	number := func(text string) (int, error) {
+		value, err := strconv.Atoi(text)
+		if err != nil || term.phrase {
+			return 0, &QueryError{term.pos, fmt.Sprintf("'%s:' expects a number, found '%s'", term.prefix, text)}
+		}
+		return value, nil
+	}
+
+	if lower, upper, isRange := strings.Cut(term.text, ".."); isRange {
+		if lower == "" && upper == "" {
+			return model.SongFilter{}, &QueryError{term.pos, fmt.Sprintf("'%s:' range without limits", term.prefix)}
+		}
+		var filters []model.SongFilter
+		from, to := 0, 0
+		var err error
+		if lower != "" {
+			if from, err = number(lower); err != nil {
+				return model.SongFilter{}, err
+			}
+			filter, err := db.NumberFilter(term.field, ">=", from)
+			if err != nil {
+				return model.SongFilter{}, err
+			}
+			filters = append(filters, filter)
+		}
+		if upper != "" {
+			if to, err = number(upper); err != nil {
+				return model.SongFilter{}, err
+			}
+			filter, err := db.NumberFilter(term.field, "<=", to)
+			if err != nil {
+				return model.SongFilter{}, err
+			}
+			filters = append(filters, filter)
+		}
+		if lower != "" && upper != "" && from > to {
+			return model.SongFilter{}, &QueryError{term.pos, fmt.Sprintf("'%s:' range %s is empty", term.prefix, term.text)}
+		}
+		return model.AndFilters(filters...), nil
+	}
+
+	operator, text := "=", term.text
+	for _, candidate := range numberOperators {
+		if strings.HasPrefix(text, candidate) {
+			operator, text = candidate, strings.TrimPrefix(text, candidate)
+			break
+		}
+	}
+	value, err := number(text)
+	if err != nil {
+		return model.SongFilter{}, err
+	}
+	return db.NumberFilter(term.field, operator, value)
+}
+
+// BuildSearchFilter parses a search written in the search language and compiles it into a
+// filter over the songs of the database.
+func BuildSearchFilter(db *model.DataBase, search string) (model.SongFilter, error) {
+	node, err := parseQuery(search)
+	if err != nil {
+		return model.SongFilter{}, err
+	}
+	return compileQuery(db, node)
+}
@@ -3,64 +3,270 @@ package main
 import (
 	"github.com/KevinJGard/MusicDB/src/model"
 	"github.com/KevinJGard/MusicDB/src/controller"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 	"log"
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if len(os.Args) == 2 && os.Args[1] == "sync" {
+		syncTags(ctx)
+		return
+	}
+	if len(os.Args) == 2 && os.Args[1] == "report" {
+		lastReport()
+		return
+	}
+	if len(os.Args) == 2 && os.Args[1] == "duplicates" {
+		duplicates()
+		return
+	}
+	if len(os.Args) >= 5 && os.Args[1] == "merge" {
+		merge(os.Args[2], os.Args[3], os.Args[4:])
+		return
+	}
 	if len(os.Args) != 3 {
-		log.Fatalf("Usage: %s <directory> <search>", os.Args[0])
+		log.Fatalf("Usage: %[1]s <directory> <search> | %[1]s watch <directory> | %[1]s infer <directory> | %[1]s sync | %[1]s report | %[1]s duplicates | %[1]s merge performers|albums <survivor ID> <duplicate ID>...", os.Args[0])
 	}
-	config := model.NewConfig()
-	err := config.SetDirectory(os.Args[1])
+
+	if os.Args[1] == "watch" {
+		watch(ctx, os.Args[2])
+		return
+	}
+	if os.Args[1] == "infer" {
+		infer(os.Args[2])
+		return
+	}
+
+	controller := controller.NewController()
+	err := controller.SetMusicDirectory(os.Args[1])
 	if err != nil {
 		log.Fatalf("Error setting directory: %v", err)
 	}
-	directory := config.MusicDirectory
-	miner := model.NewMiner()
-	database := model.NewDataBase()
-	controller := controller.NewController()
-	songs, err := controller.GetSearchSongs(os.Args[2])
+	directory := controller.Config.MusicDirectory
+	miner := controller.Miner
+	songs, err := controller.GetSearchSongs(os.Args[2], model.SearchOptions{})
 	if err != nil {
 		log.Fatalf("Error searching songs: %v", err)
 	}
 	fmt.Println("Search results:")
 	for _, song := range songs {
-		fmt.Printf("Title: %s, Artist: %s, Album: %s, Year: %d\n", song.Title, song.PerformerName, song.AlbumName, song.Year)
+		fmt.Printf("Title: %s, Artist: %s, Album: %s, Year: %d\n", song.Title, controller.ArtistCredit(song), song.AlbumName, song.Year)
 	}
 
-	files, err := miner.FindMP3Files(directory)
+	files, err := miner.FindAudioFiles(directory)
 	if err != nil {
 		log.Fatalf("Error traversing directory %s: %v", directory, err)
 	}
-	fmt.Println("MP3 files found:")
+	fmt.Println("Audio files found:")
 	for i, file := range files {
+		if ctx.Err() != nil {
+			log.Fatalf("Interrupted.")
+		}
 		metadata, err := miner.MineMetadata(file)
 		if err != nil {
 			log.Printf("Error reading metadata for %s: %v", file, err)
 			continue
 		}
 		fmt.Printf("File: %s \n", file)
-		fmt.Printf("Title: %s \n", metadata["Title"])
-		fmt.Printf("Artist: %s \n", metadata["Artist"])
-		fmt.Printf("Album: %s \n", metadata["Album"])
-		fmt.Printf("AlbumArtist: %s \n", metadata["AlbumArtist"])
-		fmt.Printf("Genre: %s \n", metadata["Genre"])
-		fmt.Printf("Year: %d \n", metadata["Year"])
-		disc := metadata["Disc"].(map[string]int)
-		fmt.Printf("Disc Number: %d \n", disc["Number"])
-		fmt.Printf("Comment: %s \n", metadata["Comment"])
-		track := metadata["Track"].(map[string]int)
-		fmt.Printf("Track: %d of %d \n", track["Number"], track["Total"])
-		fmt.Printf("Composer: %s \n", metadata["Composer"])
+		fmt.Printf("Title: %s \n", metadata.Title)
+		fmt.Printf("Artist: %s \n", strings.ReplaceAll(metadata.Artist, "\x00", "; "))
+		fmt.Printf("Album: %s \n", metadata.Album)
+		fmt.Printf("AlbumArtist: %s \n", metadata.AlbumArtist)
+		fmt.Printf("Genre: %s \n", metadata.Genre)
+		fmt.Printf("Year: %d \n", metadata.Year)
+		fmt.Printf("Disc: %d of %d \n", metadata.Disc, metadata.DiscTotal)
+		fmt.Printf("Comment: %s \n", metadata.Comment)
+		fmt.Printf("Track: %d of %d \n", metadata.Track, metadata.TrackTotal)
+		fmt.Printf("Composer: %s \n", metadata.Composer)
+		fmt.Printf("Format: %s (%s tags) \n", metadata.Format, metadata.TagFormat)
+		fmt.Printf("Audio: %s \n", metadata.Audio)
 		fmt.Printf("%d----------------------------------------------------------------------\n", i)
+	}
+
+	report, err := controller.MineMetadata(ctx,
+		func(progress int) {
+			fmt.Printf("\rMining metadata: %d%%", progress)
+		},
+		func() {
+			fmt.Println()
+		},
+	)
+	if errors.Is(err, context.Canceled) {
+		log.Fatalf("\nMining was cancelled.")
+	}
+	if err != nil {
+		log.Fatalf("Error mining metadata: %v", err)
+	}
 
-		if err := miner.ProcessFile(database, file); err != nil {
-			log.Printf("Error procesing file %s: %v", file, err)
+	printReport(report)
+}
+
+// watch mines the directory and then keeps the database in sync with it until interrupted.
+func watch(ctx context.Context, directory string) {
+	controller := controller.NewController()
+	if err := controller.SetMusicDirectory(directory); err != nil {
+		log.Fatalf("Error setting directory: %v", err)
+	}
+	report, err := controller.MineMetadata(ctx,
+		func(progress int) {
+			fmt.Printf("\rMining metadata: %d%%", progress)
+		},
+		func() {
+			fmt.Println()
+		},
+	)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Error mining metadata: %v", err)
+	}
+	printReport(report)
+
+	fmt.Printf("Watching %s, press Ctrl-C to stop.\n", controller.Config.MusicDirectory)
+	err = controller.Watch(ctx, func() {
+		fmt.Println("Library updated.")
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Error watching directory: %v", err)
+	}
+}
+
+// infer prints the tags the configured filename patterns infer for each file in the directory,
+// without changing the database.
+func infer(directory string) {
+	controller := controller.NewController()
+	previews, err := controller.PreviewInferredTags(directory)
+	if err != nil {
+		log.Fatalf("Error inferring tags: %v", err)
+	}
+	for _, preview := range previews {
+		metadata := preview.Metadata
+		fmt.Printf("File: %s \n", preview.File)
+		if len(preview.Inferred) == 0 {
+			fmt.Println("Nothing inferred.")
 			continue
 		}
+		fmt.Printf("Inferred: %s \n", strings.Join(preview.Inferred, ", "))
+		fmt.Printf("Artist: %s, Album: %s, Year: %d, Disc: %d, Track: %d, Title: %s \n",
+			metadata.Artist, metadata.Album, metadata.Year, metadata.Disc, metadata.Track, metadata.Title)
+	}
+}
+
+// syncTags writes the tags of every MP3 song in the database into its file.
+func syncTags(ctx context.Context) {
+	controller := controller.NewController()
+	written, err := controller.SyncTagsToFiles(ctx, func(progress int) {
+		fmt.Printf("\rWriting tags: %d%%", progress)
+	})
+	fmt.Println()
+	if errors.Is(err, context.Canceled) {
+		log.Fatalf("Writing was cancelled after %d files.", written)
+	}
+	if err != nil {
+		log.Printf("Error writing tags: %v", err)
+	}
+	fmt.Printf("Tags were written to %d files.\n", written)
+}
+
+// printReport prints what a mining did, the files that failed and the warnings.
+func printReport(report model.ScanReport) {
+	fmt.Printf("%d files scanned in %s: %d added, %d updated, %d moved, %d skipped, %d failed, %d songs missing.\n",
+		report.Scanned, report.Elapsed.Round(time.Millisecond), report.Added, report.Updated, report.Moved,
+		report.Skipped, report.Failed, report.Missing)
+	for _, failure := range report.Failures {
+		fmt.Printf("Failed %s: %s\n", failure.File, failure.Reason)
+	}
+	for _, warning := range report.Warnings {
+		fmt.Printf("Warning %s: %s\n", warning.File, warning.Reason)
+	}
+}
+
+// lastReport prints the report of the last mining as JSON.
+func lastReport() {
+	controller := controller.NewController()
+	report, ok, err := controller.LastScanReport()
+	if err != nil {
+		log.Fatalf("Error reading the last scan report: %v", err)
+	}
+	if !ok {
+		log.Fatalf("The library was never mined.")
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatalf("Error encoding the report: %v", err)
+	}
+	fmt.Println(string(data))
+}
+
+// duplicates prints the performers and albums that are likely duplicates, with their IDs to
+// merge them.
+func duplicates() {
+	controller := controller.NewController()
+	performers, err := controller.FindDuplicatePerformers()
+	if err != nil {
+		log.Fatalf("Error finding duplicate performers: %v", err)
+	}
+	albums, err := controller.FindDuplicateAlbums()
+	if err != nil {
+		log.Fatalf("Error finding duplicate albums: %v", err)
+	}
+	fmt.Println("Performers:")
+	printDuplicates(performers)
+	fmt.Println("Albums:")
+	printDuplicates(albums)
+}
+
+// printDuplicates prints each group of duplicates, the suggested survivor first.
+func printDuplicates(groups []model.Duplicates) {
+	if len(groups) == 0 {
+		fmt.Println("No duplicates found.")
+	}
+	for _, group := range groups {
+		fmt.Printf("%s:\n", group.Key)
+		for _, candidate := range group.Candidates {
+			fmt.Printf("  %d: %s", candidate.ID, candidate.Name)
+			if candidate.Detail != "" {
+				fmt.Printf(" (%s)", candidate.Detail)
+			}
+			fmt.Printf(", %d songs\n", candidate.Songs)
+		}
 	}
+}
 
-	fmt.Println("Everything was done correctly.")
-}
\ No newline at end of file
+// merge merges the duplicate performers or albums into the survivor, given their IDs.
+func merge(what, survivor string, duplicates []string) {
+	survivorID, err := strconv.ParseInt(survivor, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid survivor ID '%s'.", survivor)
+	}
+	var duplicateIDs []int64
+	for _, duplicate := range duplicates {
+		id, err := strconv.ParseInt(duplicate, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid duplicate ID '%s'.", duplicate)
+		}
+		duplicateIDs = append(duplicateIDs, id)
+	}
+
+	controller := controller.NewController()
+	switch what {
+	case "performers":
+		err = controller.MergePerformers(survivorID, duplicateIDs)
+	case "albums":
+		err = controller.MergeAlbums(survivorID, duplicateIDs)
+	default:
+		log.Fatalf("Can only merge performers or albums, not '%s'.", what)
+	}
+	if err != nil {
+		log.Fatalf("Error merging %s: %v", what, err)
+	}
+	fmt.Printf("Merged %d %s into %d.\n", len(duplicateIDs), what, survivorID)
+}
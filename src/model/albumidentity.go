@@ -0,0 +1,167 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+)
+
+// AlbumIdentity is the strategy that decides which songs belong to the same album. Every
+// strategy requires the same album name.
+type AlbumIdentity string
+
+const (
+	// AlbumByArtistAndDirectory groups the songs with the same album artist in the same
+	// directory. It is the default strategy.
+	AlbumByArtistAndDirectory AlbumIdentity = "artist_directory"
+	// AlbumByArtist groups the songs with the same album artist, wherever they are, so an
+	// album split in a directory per disc stays together.
+	AlbumByArtist AlbumIdentity = "artist"
+	// AlbumByDirectory groups the songs in the same directory, whatever their album artist.
+	AlbumByDirectory AlbumIdentity = "directory"
+)
+
+// Validate returns an error if the strategy is not known. The empty strategy is the default.
+func (identity AlbumIdentity) Validate() error {
+	switch identity {
+	case "", AlbumByArtistAndDirectory, AlbumByArtist, AlbumByDirectory:
+		return nil
+	}
+	return fmt.Errorf("unknown album identity '%s'", identity)
+}
+
+// albumKey returns the values that identify an album under the strategy, given its name,
+// album artist and the path of one of its songs.
+func (identity AlbumIdentity) albumKey(name string, albumArtistID int64, songPath string) [3]interface{} {
+	directory := filepath.Dir(songPath)
+	switch identity {
+	case AlbumByArtist:
+		return [3]interface{}{name, albumArtistID, nil}
+	case AlbumByDirectory:
+		return [3]interface{}{name, nil, directory}
+	}
+	return [3]interface{}{name, albumArtistID, directory}
+}
+
+// albumByKey selects an album identified by a key. A nil part of the key matches any value.
+const albumByKey = `SELECT id_album FROM albums WHERE name = ?1
+	AND (?2 IS NULL OR IFNULL(id_performer, 0) = ?2) AND (?3 IS NULL OR path = ?3)
+	ORDER BY id_album LIMIT 1`
+
+// GetOrInsertAlbum returns the ID of the album a song at songPath belongs to under the
+// strategy, inserting the album if there is none. The album artist of a new album is
+// albumArtistID, where 0 means none, and its path is the song's directory.
+func (db *DataBase) GetOrInsertAlbum(identity AlbumIdentity, name string, year int, albumArtistID int64, songPath string) (int64, error) {
+	key := identity.albumKey(name, albumArtistID, songPath)
+	var id int64
+	err := db.queryRowPrepared(albumByKey, key[:]...).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+
+	query := `INSERT INTO albums (path, name, year, id_performer) VALUES (?, ?, ?, NULLIF(?, 0))`
+	result, err := db.execPrepared(query, filepath.Dir(songPath), name, year, albumArtistID)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// regroupAlbums assigns every song to the album it belongs to under the strategy. Albums
+// keep their ID when they are the first one of their group; songs split from an album get a
+// copy of it, and albums merged into another one are deleted once they have no songs left.
+// It returns the IDs of the albums whose songs or directory changed.
+func regroupAlbums(tx *sql.Tx, identity AlbumIdentity) ([]int64, error) {
+	rows, err := tx.Query(`SELECT r.id_rola, r.path, a.id_album, IFNULL(a.name, ''), IFNULL(a.year, 0),
+		IFNULL(a.id_performer, 0) FROM rolas r JOIN albums a ON a.id_album = r.id_album ORDER BY a.id_album, r.id_rola`)
+	if err != nil {
+		return nil, err
+	}
+	type song struct {
+		id, album, albumArtist int64
+		path, name string
+		year int
+	}
+	var songs []song
+	for rows.Next() {
+		var s song
+		if err := rows.Scan(&s.id, &s.path, &s.album, &s.name, &s.year, &s.albumArtist); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		songs = append(songs, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var touched []int64
+	groups := make(map[[3]interface{}]int64)
+	claimed := make(map[int64]bool)
+	emptied := make(map[int64]bool)
+	for _, s := range songs {
+		key := identity.albumKey(s.name, s.albumArtist, s.path)
+		album, ok := groups[key]
+		if !ok {
+			if claimed[s.album] {
+				query := `INSERT INTO albums (path, name, year, id_performer) VALUES (?, ?, ?, NULLIF(?, 0))`
+				result, err := tx.Exec(query, filepath.Dir(s.path), s.name, s.year, s.albumArtist)
+				if err != nil {
+					return nil, err
+				}
+				if album, err = result.LastInsertId(); err != nil {
+					return nil, err
+				}
+				touched = append(touched, album)
+			} else {
+				album = s.album
+				claimed[album] = true
+				if identity != AlbumByArtist {
+					query := `UPDATE albums SET path = ?1 WHERE id_album = ?2 AND path IS NOT ?1`
+					result, err := tx.Exec(query, filepath.Dir(s.path), album)
+					if err != nil {
+						return nil, err
+					}
+					if moved, err := result.RowsAffected(); err != nil {
+						return nil, err
+					} else if moved > 0 {
+						touched = append(touched, album)
+					}
+				}
+			}
+			groups[key] = album
+		}
+		if album != s.album {
+			emptied[s.album] = true
+			touched = append(touched, album, s.album)
+			if _, err := tx.Exec(`UPDATE rolas SET id_album = ? WHERE id_rola = ?`, album, s.id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for album := range emptied {
+		query := `DELETE FROM albums WHERE id_album = ? AND NOT EXISTS (SELECT 1 FROM rolas WHERE id_album = ?)`
+		if _, err := tx.Exec(query, album, album); err != nil {
+			return nil, err
+		}
+	}
+	return touchedAlbums(touched...), nil
+}
+
+// RegroupAlbums assigns every song to the album it belongs to under the strategy, used after
+// the strategy changes. It returns the IDs of the albums whose songs or directory changed.
+func (db *DataBase) RegroupAlbums(identity AlbumIdentity) ([]int64, error) {
+	tx, err := db.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	touched, err := regroupAlbums(tx, identity)
+	if err != nil {
+		return nil, err
+	}
+	return touched, tx.Commit()
+}
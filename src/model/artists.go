@@ -0,0 +1,161 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultArtistSeparators split an artist tag into the performers credited as its artists.
+var DefaultArtistSeparators = []string{"&", ";"}
+
+// DefaultFeaturedSeparators introduce the performers featured in a song in its artist tag.
+var DefaultFeaturedSeparators = []string{"feat.", "ft.", "featuring"}
+
+// ArtistSplitter splits artist tags such as "Daft Punk feat. Pharrell Williams" or "A & B"
+// into the performers credited on a song. Separators divide the artists, and the performers
+// after any of Featured are featured artists. Both match ignoring case, and a separator that
+// starts or ends with a letter only matches there at the edge of a word. The null character,
+// which divides the values of ID3v2.4 texts, always separates artists.
+type ArtistSplitter struct {
+	Separators []string
+	Featured []string
+}
+
+// DefaultArtistSplitter returns the splitter with the default separators.
+func DefaultArtistSplitter() ArtistSplitter {
+	return ArtistSplitter{Separators: DefaultArtistSeparators, Featured: DefaultFeaturedSeparators}
+}
+
+// Split returns the primary and featured artists of an artist tag, without repeating any of
+// them. A tag with only featured artists has them as its primary artists.
+func (splitter ArtistSplitter) Split(artist string) ([]string, []string) {
+	var primary, featured []string
+	for _, value := range strings.Split(artist, "\x00") {
+		main, guests := value, ""
+		if start, end := indexSeparator(value, splitter.Featured); start >= 0 {
+			main, guests = value[:start], value[end:]
+			if opening := strings.TrimRightFunc(main, unicode.IsSpace); strings.HasSuffix(opening, "(") {
+				main = strings.TrimSuffix(opening, "(")
+				guests = strings.TrimSuffix(strings.TrimRightFunc(guests, unicode.IsSpace), ")")
+			}
+		}
+		primary = append(primary, splitter.splitArtists(main)...)
+		featured = append(featured, splitter.splitArtists(guests)...)
+	}
+	if len(primary) == 0 {
+		primary, featured = featured, nil
+	}
+	primary = uniqueNames(primary, nil)
+	return primary, uniqueNames(featured, primary)
+}
+
+// Join writes artists back as one artist tag, divided by the first separator and with the
+// featured artists after the first featured separator.
+func (splitter ArtistSplitter) Join(primary, featured []string) string {
+	separator, introduction := "; ", "feat."
+	for _, text := range splitter.Separators {
+		if text = strings.TrimSpace(text); text != "" {
+			separator = " " + text + " "
+			if text == ";" {
+				separator = "; "
+			}
+			break
+		}
+	}
+	for _, text := range splitter.Featured {
+		if text = strings.TrimSpace(text); text != "" {
+			introduction = text
+			break
+		}
+	}
+	artist := strings.Join(primary, separator)
+	if len(featured) > 0 {
+		artist += " " + introduction + " " + strings.Join(featured, separator)
+	}
+	return artist
+}
+
+// splitArtists divides a text by every separator, trimming each artist and dropping the
+// empty ones.
+func (splitter ArtistSplitter) splitArtists(text string) []string {
+	var artists []string
+	for {
+		start, end := indexSeparator(text, splitter.Separators)
+		if start < 0 {
+			break
+		}
+		artists = appendArtist(artists, text[:start])
+		text = text[end:]
+	}
+	return appendArtist(artists, text)
+}
+
+// appendArtist appends the trimmed artist unless it is empty. Byte order marks are dropped,
+// since every value of an UTF-16 ID3v2.4 text may start with one.
+func appendArtist(artists []string, artist string) []string {
+	artist = strings.TrimSpace(strings.ReplaceAll(artist, "\ufeff", ""))
+	if artist == "" {
+		return artists
+	}
+	return append(artists, artist)
+}
+
+// uniqueNames returns the names without repeating any of them, nor any of those in skip,
+// ignoring case.
+func uniqueNames(names, skip []string) []string {
+	seen := make(map[string]bool)
+	for _, name := range skip {
+		seen[strings.ToLower(name)] = true
+	}
+	var unique []string
+	for _, name := range names {
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// indexSeparator returns where the first of the separators found in text starts and ends, or
+// -1 if there is none. Empty separators are ignored.
+func indexSeparator(text string, separators []string) (int, int) {
+	for i := 0; i < len(text); i++ {
+		for _, separator := range separators {
+			separator = strings.TrimSpace(separator)
+			if separator == "" || i+len(separator) > len(text) || !strings.EqualFold(text[i:i+len(separator)], separator) {
+				continue
+			}
+			if isWordEdge(text, i, separator, false) && isWordEdge(text, i+len(separator), separator, true) {
+				return i, i + len(separator)
+			}
+		}
+	}
+	return -1, -1
+}
+
+// isWordEdge reports whether a separator can start or, when after is true, end at the given
+// position of text: a separator starting or ending in a letter or digit must not be next to
+// another one.
+func isWordEdge(text string, position int, separator string, after bool) bool {
+	if after {
+		last, _ := utf8.DecodeLastRuneInString(separator)
+		if !isWordRune(last) || position == len(text) {
+			return true
+		}
+		next, _ := utf8.DecodeRuneInString(text[position:])
+		return !isWordRune(next)
+	}
+	first, _ := utf8.DecodeRuneInString(separator)
+	if !isWordRune(first) || position == 0 {
+		return true
+	}
+	previous, _ := utf8.DecodeLastRuneInString(text[:position])
+	return !isWordRune(previous)
+}
+
+// isWordRune reports whether r is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx, so the same methods run inside a batch
+// or outside of it.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// statementCache holds the statements prepared on a database, shared by all its batches.
+type statementCache struct {
+	mutex sync.Mutex
+	statements map[string]*sql.Stmt
+}
+
+// prepare returns the statement of a query, preparing it the first time.
+func (cache *statementCache) prepare(db *sql.DB, query string) (*sql.Stmt, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if stmt, ok := cache.statements[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if cache.statements == nil {
+		cache.statements = make(map[string]*sql.Stmt)
+	}
+	cache.statements[query] = stmt
+	return stmt, nil
+}
+
+// errorRow is the row of a statement that could not be prepared.
+type errorRow struct {
+	err error
+}
+
+// Scan returns the error preparing the statement.
+func (row errorRow) Scan(dest ...interface{}) error {
+	return row.err
+}
+
+// Begin starts a batch of writes: the returned database runs every statement inside one
+// transaction until Commit or Rollback is called on it, so many writes share a single sync
+// to disk and none of them is stored if the batch is rolled back.
+func (db *DataBase) Begin() (*DataBase, error) {
+	if db.tx != nil {
+		return nil, errors.New("a batch is already in progress")
+	}
+	tx, err := db.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &DataBase{
+		Db: db.Db,
+		searchIndex: db.searchIndex,
+		statements: db.statements,
+		tx: tx,
+		txStatements: make(map[string]*sql.Stmt),
+	}, nil
+}
+
+// Commit stores the writes of the batch.
+func (db *DataBase) Commit() error {
+	if db.tx == nil {
+		return errors.New("no batch in progress")
+	}
+	return db.tx.Commit()
+}
+
+// Rollback discards the writes of the batch. It does nothing once the batch is committed.
+func (db *DataBase) Rollback() error {
+	if db.tx == nil {
+		return errors.New("no batch in progress")
+	}
+	if err := db.tx.Rollback(); err != sql.ErrTxDone {
+		return err
+	}
+	return nil
+}
+
+// conn returns where the statements run: the transaction of the batch, or the database
+// outside a batch.
+func (db *DataBase) conn() execer {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.Db
+}
+
+// prepared returns the statement of a query, prepared once and reused by every later call,
+// and bound to the transaction inside a batch.
+func (db *DataBase) prepared(query string) (*sql.Stmt, error) {
+	stmt, err := db.statements.prepare(db.Db, query)
+	if err != nil || db.tx == nil {
+		return stmt, err
+	}
+	if bound, ok := db.txStatements[query]; ok {
+		return bound, nil
+	}
+	bound := db.tx.Stmt(stmt)
+	db.txStatements[query] = bound
+	return bound, nil
+}
+
+// execPrepared runs a prepared statement that returns no rows.
+func (db *DataBase) execPrepared(query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := db.prepared(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+// queryRowPrepared runs a prepared statement that returns at most one row.
+func (db *DataBase) queryRowPrepared(query string, args ...interface{}) rowScanner {
+	stmt, err := db.prepared(query)
+	if err != nil {
+		return errorRow{err}
+	}
+	return stmt.QueryRow(args...)
+}
+
+// transaction runs apply with a database whose statements run inside a transaction, stored
+// only if apply succeeds. Inside a batch it is a savepoint of the batch, so a failure only
+// undoes the writes of apply.
+func (db *DataBase) transaction(apply func(tx *DataBase) error) error {
+	if db.tx == nil {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := apply(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if _, err := db.tx.Exec(`SAVEPOINT apply`); err != nil {
+		return err
+	}
+	if err := apply(db); err != nil {
+		if _, rollbackErr := db.tx.Exec(`ROLLBACK TO apply`); rollbackErr != nil {
+			return rollbackErr
+		}
+		if _, releaseErr := db.tx.Exec(`RELEASE apply`); releaseErr != nil {
+			return releaseErr
+		}
+		return err
+	}
+	_, err := db.tx.Exec(`RELEASE apply`)
+	return err
+}
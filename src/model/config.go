@@ -4,13 +4,40 @@ import (
 	"os"
 	"path/filepath"
 	"encoding/json"
+	"fmt"
 	"log"
+	"runtime"
 	"strings"
+	"time"
 )
 
-// Config holds the music directory path where the MP3 files are located.
+// Config holds the music directory where the audio files are located and how it is mined.
 type Config struct {
 	MusicDirectory string `json:"music_directory"`
+	// Workers is the number of workers that mine in parallel, where 0 means one per CPU.
+	Workers int `json:"workers,omitempty"`
+	// PruneMissing deletes the songs whose file disappeared instead of flagging them as missing.
+	PruneMissing bool `json:"prune_missing,omitempty"`
+	// PruneOrphans deletes the albums and performers left without songs.
+	PruneOrphans bool `json:"prune_orphans,omitempty"`
+	// WatchDelay is how many milliseconds the directory must stay quiet before the changes
+	// seen while watching it are applied.
+	WatchDelay int `json:"watch_delay_ms,omitempty"`
+	// AlbumIdentity decides which songs belong to the same album.
+	AlbumIdentity AlbumIdentity `json:"album_identity,omitempty"`
+	// FilenamePatterns infer tags from the paths of the files, filling the missing ones unless
+	// FilenameMode is "override".
+	FilenamePatterns []string `json:"filename_patterns,omitempty"`
+	FilenameMode PatternMode `json:"filename_mode,omitempty"`
+	// ID3Version is the version, 3 or 4, of the ID3v2 tags written to files that have none.
+	ID3Version int `json:"id3_version,omitempty"`
+	// ArtistSeparators split the artist tags into the performers credited on each song, and
+	// FeaturedSeparators introduce the featured ones; each list has its defaults when empty,
+	// and [""] splits nothing.
+	ArtistSeparators []string `json:"artist_separators,omitempty"`
+	FeaturedSeparators []string `json:"featured_separators,omitempty"`
+	// BatchSize is how many files are stored in each transaction while mining.
+	BatchSize int `json:"batch_size,omitempty"`
 }
 
 // NewConfig creates a new Config instance.
@@ -70,6 +97,84 @@ func (config *Config) SetDirectory(newDir string) error {
 	return SaveConfig(configFile, config)
 }
 
+// WorkerCount returns the number of workers used to mine metadata.
+func (config *Config) WorkerCount() int {
+	if config.Workers > 0 {
+		return config.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// WatchDelayDuration returns how long the directory must stay quiet before applying the changes
+// seen while watching it, two seconds by default.
+func (config *Config) WatchDelayDuration() time.Duration {
+	if config.WatchDelay > 0 {
+		return time.Duration(config.WatchDelay) * time.Millisecond
+	}
+	return 2 * time.Second
+}
+
+// MiningBatchSize returns how many files are stored in each transaction while mining, 500
+// by default.
+func (config *Config) MiningBatchSize() int {
+	if config.BatchSize > 0 {
+		return config.BatchSize
+	}
+	return 500
+}
+
+// AlbumIdentityStrategy returns the strategy that identifies albums, by album artist and
+// directory by default.
+func (config *Config) AlbumIdentityStrategy() AlbumIdentity {
+	if config.AlbumIdentity == "" {
+		return AlbumByArtistAndDirectory
+	}
+	return config.AlbumIdentity
+}
+
+// ID3TagVersion returns the version of the ID3v2 tags written to files that have none,
+// ID3v2.4 by default.
+func (config *Config) ID3TagVersion() int {
+	if config.ID3Version == 0 {
+		return 4
+	}
+	return config.ID3Version
+}
+
+// ArtistSplitter returns the splitter of the artist tags, with the default separators for the
+// lists that are not configured.
+func (config *Config) ArtistSplitter() ArtistSplitter {
+	splitter := DefaultArtistSplitter()
+	if len(config.ArtistSeparators) > 0 {
+		splitter.Separators = config.ArtistSeparators
+	}
+	if len(config.FeaturedSeparators) > 0 {
+		splitter.Featured = config.FeaturedSeparators
+	}
+	return splitter
+}
+
+// CompilePatterns parses the filename patterns and checks their mode, fallback by default.
+func (config *Config) CompilePatterns() ([]*FilenamePattern, PatternMode, error) {
+	mode := config.FilenameMode
+	switch mode {
+	case "":
+		mode = PatternFallback
+	case PatternFallback, PatternOverride:
+	default:
+		return nil, "", fmt.Errorf("unknown filename mode '%s'", mode)
+	}
+	var patterns []*FilenamePattern
+	for _, text := range config.FilenamePatterns {
+		pattern, err := CompilePattern(text)
+		if err != nil {
+			return nil, "", err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, mode, nil
+}
+
 // GetDefaultDir returns the default music directory based on the user's language setting.
 func GetDefaultDir() string {
 	lang := os.Getenv("LANG")
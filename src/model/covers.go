@@ -0,0 +1,186 @@
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"golang.org/x/image/draw"
+)
+
+// coverFileNames are the names, in any case and in order of preference, of the pictures
+// used as the cover of an album whose songs have none embedded.
+var coverFileNames = []string{
+	"cover.jpg", "cover.jpeg", "cover.png",
+	"folder.jpg", "folder.jpeg", "folder.png",
+	"front.jpg", "front.jpeg", "front.png",
+}
+
+// CoverCache stores cover pictures by the hex encoded SHA-256 of their content, so a picture
+// shared by many songs is stored once. Each picture is kept along with a thumbnail that fits
+// in a square of ThumbnailSize pixels.
+type CoverCache struct {
+	Dir string
+	ThumbnailSize int
+}
+
+// NewCoverCache creates the cover cache of the user, in ~/.cache/MusicDB/covers.
+func NewCoverCache() *CoverCache {
+	return &CoverCache{
+		Dir: filepath.Join(os.Getenv("HOME"), ".cache", "MusicDB", "covers"),
+		ThumbnailSize: 256,
+	}
+}
+
+// Path returns where the picture with the given hash is stored.
+func (cache *CoverCache) Path(hash string) string {
+	return filepath.Join(cache.Dir, hash[:2], hash)
+}
+
+// ThumbnailPath returns where the thumbnail of the picture with the given hash is stored.
+func (cache *CoverCache) ThumbnailPath(hash string) string {
+	return cache.Path(hash) + ".thumb.jpg"
+}
+
+// Store adds a picture to the cache, with its thumbnail, and returns its hash. A picture that
+// is already cached is not written again, and data that is not a JPEG, PNG or GIF image is
+// refused.
+func (cache *CoverCache) Store(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if _, err := os.Stat(cache.ThumbnailPath(hash)); err == nil {
+		return hash, nil
+	}
+
+	picture, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("decoding cover: %v", err)
+	}
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, cache.thumbnail(picture), &jpeg.Options{Quality: 85}); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(cache.Path(hash)), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(cache.Path(hash), data); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(cache.ThumbnailPath(hash), thumbnail.Bytes()); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// StoreDirectoryCover stores the cover picture found in a directory, such as cover.jpg or
+// folder.png, and returns its hash. It returns an empty hash when there is none.
+func (cache *CoverCache) StoreDirectoryCover(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files[strings.ToLower(entry.Name())] = entry.Name()
+		}
+	}
+	for _, name := range coverFileNames {
+		if file, ok := files[name]; ok {
+			data, err := os.ReadFile(filepath.Join(dir, file))
+			if err != nil {
+				return "", err
+			}
+			return cache.Store(data)
+		}
+	}
+	return "", nil
+}
+
+// thumbnail scales a picture down to fit in the thumbnail size, keeping its proportions.
+// Smaller pictures are kept as they are.
+func (cache *CoverCache) thumbnail(picture image.Image) image.Image {
+	bounds := picture.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= cache.ThumbnailSize && height <= cache.ThumbnailSize {
+		return picture
+	}
+	if width > height {
+		width, height = cache.ThumbnailSize, max(height*cache.ThumbnailSize/width, 1)
+	} else {
+		width, height = max(width*cache.ThumbnailSize/height, 1), cache.ThumbnailSize
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), picture, bounds, draw.Src, nil)
+	return scaled
+}
+
+// writeFileAtomic writes a file through a temporary file renamed over it, so it is never
+// seen half written.
+func writeFileAtomic(file string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), file)
+}
+
+// RefreshAlbumCovers sets the cover of each of the albums to the picture embedded in its
+// first song that has one. An album whose songs have none keeps its cover, such as the one
+// found in its directory.
+func (db *DataBase) RefreshAlbumCovers(albumIDs []int64) error {
+	query := `UPDATE albums SET cover = IFNULL((SELECT r.cover FROM rolas r
+		WHERE r.id_album = albums.id_album AND r.cover IS NOT NULL ORDER BY r.disc, r.track, r.id_rola LIMIT 1), cover)
+		WHERE id_album = ?`
+	for _, id := range albumIDs {
+		if _, err := db.execPrepared(query, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAlbumsWithoutCover returns those of the albums that have no cover.
+func (db *DataBase) GetAlbumsWithoutCover(albumIDs []int64) ([]Album, error) {
+	query := `SELECT id_album, IFNULL(path, ''), IFNULL(name, ''), IFNULL(year, 0) FROM albums
+		WHERE id_album = ? AND cover IS NULL`
+	var albums []Album
+	for _, id := range albumIDs {
+		var album Album
+		err := db.queryRowPrepared(query, id).Scan(&album.ID, &album.Path, &album.Name, &album.Year)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, nil
+}
+
+// SetAlbumCover sets the hash of the cover of an album.
+func (db *DataBase) SetAlbumCover(albumID int64, hash string) error {
+	_, err := db.conn().Exec(`UPDATE albums SET cover = NULLIF(?, '') WHERE id_album = ?`, hash, albumID)
+	return err
+}
@@ -0,0 +1,93 @@
+package model
+
+const (
+	// RoleComposer is the role of the performers credited as composers of a song.
+	RoleComposer = "composer"
+	// RoleArtist is the role of the performers credited as artists of a song, the first of
+	// them being its performer.
+	RoleArtist = "artist"
+	// RoleFeatured is the role of the performers featured in a song.
+	RoleFeatured = "featured"
+)
+
+// composerNames selects the names of the composers of the song aliased as r, separated
+// by semicolons.
+const composerNames = `(SELECT group_concat(cp.name, '; ') FROM credits c
+		JOIN performers cp ON cp.id_performer = c.id_performer
+		WHERE c.id_rola = r.id_rola AND c.role = 'composer')`
+
+// artistNames selects the names of the artists of the song aliased as r besides its
+// performer, separated by semicolons in the order they were credited.
+const artistNames = `(SELECT group_concat(cp.name, '; ' ORDER BY c.rowid) FROM credits c
+		JOIN performers cp ON cp.id_performer = c.id_performer
+		WHERE c.id_rola = r.id_rola AND c.role = 'artist' AND c.id_performer IS NOT r.id_performer)`
+
+// featuredNames selects the names of the performers featured in the song aliased as r,
+// separated by semicolons in the order they were credited.
+const featuredNames = `(SELECT group_concat(cp.name, '; ' ORDER BY c.rowid) FROM credits c
+		JOIN performers cp ON cp.id_performer = c.id_performer
+		WHERE c.id_rola = r.id_rola AND c.role = 'featured')`
+
+// performerNames selects the name of the performer of the song aliased as r followed by the
+// names of its other artists and of the featured ones, so any of them is searched.
+const performerNames = `(p.name || IFNULL('; ' || ` + artistNames + `, '') || IFNULL('; ' || ` + featuredNames + `, ''))`
+
+// SetCredits replaces the performers credited in a role of a song.
+func (db *DataBase) SetCredits(songID int64, role string, performerIDs []int64) error {
+	return db.transaction(func(tx *DataBase) error {
+		if _, err := tx.execPrepared(`DELETE FROM credits WHERE id_rola = ? AND role = ?`, songID, role); err != nil {
+			return err
+		}
+		for _, performerID := range performerIDs {
+			query := `INSERT OR IGNORE INTO credits (id_rola, id_performer, role) VALUES (?, ?, ?)`
+			if _, err := tx.execPrepared(query, songID, performerID, role); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetCredits returns the performers credited in a role of a song.
+func (db *DataBase) GetCredits(songID int64, role string) ([]Performer, error) {
+	query := `SELECT p.id_performer, IFNULL(p.id_type, 2), IFNULL(p.name, '') FROM credits c
+		JOIN performers p ON p.id_performer = c.id_performer
+		WHERE c.id_rola = ? AND c.role = ? ORDER BY p.name`
+	rows, err := db.conn().Query(query, songID, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var performers []Performer
+	for rows.Next() {
+		var performer Performer
+		if err := rows.Scan(&performer.ID, &performer.Type, &performer.Name); err != nil {
+			return nil, err
+		}
+		performers = append(performers, performer)
+	}
+	return performers, rows.Err()
+}
+
+// SetAlbumArtist credits a performer as the artist of an album, or clears it for ID 0.
+// The album is left untouched when it already has that artist.
+func (db *DataBase) SetAlbumArtist(albumID, performerID int64) error {
+	query := `UPDATE albums SET id_performer = NULLIF(?1, 0) WHERE id_album = ?2 AND id_performer IS NOT NULLIF(?1, 0)`
+	_, err := db.execPrepared(query, performerID, albumID)
+	return err
+}
+
+// fillAlbumArtist credits a performer as the artist of an album that has none, so songs of
+// the same album with different album artists do not keep overwriting it.
+func (db *DataBase) fillAlbumArtist(albumID, performerID int64) error {
+	_, err := db.execPrepared(`UPDATE albums SET id_performer = ? WHERE id_album = ? AND id_performer IS NULL`, performerID, albumID)
+	return err
+}
+
+// UpdateSongDetails updates the disc number and comment of a song.
+func (db *DataBase) UpdateSongDetails(idRola int64, disc int, comment string) error {
+	query := `UPDATE rolas SET disc = ?, comment = NULLIF(?, '') WHERE id_rola = ?`
+	_, err := db.conn().Exec(query, disc, comment, idRola)
+	return err
+}
@@ -5,127 +5,114 @@ import (
 	"os"
 	"path/filepath"
 	"database/sql"
+	"time"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// DataBase represents the SQLite database connection.
+// DataBase represents the SQLite database connection. A DataBase returned by Begin runs its
+// statements inside the transaction of a batch.
 type DataBase struct {
 	Db *sql.DB
+	searchIndex bool
+	statements *statementCache
+	tx *sql.Tx
+	txStatements map[string]*sql.Stmt
 }
 
 // NewDataBase initializes a new instance of DataBase.
-// Creates the database directory and file if it does not exist and sets up the tables.
+// Creates the database directory and file if it does not exist and brings the schema up to date.
 func NewDataBase() *DataBase {
 	dbDir := filepath.Join(os.Getenv("HOME"), ".local", "share", "MusicDB")
 	os.MkdirAll(dbDir, os.ModePerm)
 	dbFile := filepath.Join(dbDir, "music.db")
 
-	database, err := sql.Open("sqlite3", dbFile)
+	database, err := OpenDataBase(dbFile)
 	if err != nil {
 		log.Fatalf("Error opening database: %v", err)
 	}
+	return database
+}
 
-	if err := createTables(database); err != nil {
-		log.Fatalf("Error creating tables: %v", err)
-	}
-
-	return &DataBase{Db: database}
-}
-
-// createTables creates the database tables if they do not exist.
-func createTables(db *sql.DB) error {
-	tableCreationQueries := []string {
-		`CREATE TABLE IF NOT EXISTS types (
-			id_type INTEGER PRIMARY KEY,
-			description TEXT
-		);`,
-		`INSERT OR IGNORE INTO types (id_type, description) VALUES (0, 'Person');`,
-		`INSERT OR IGNORE INTO types (id_type, description) VALUES (1, 'Group');`,
-		`INSERT OR IGNORE INTO types (id_type, description) VALUES (2, 'Unknown');`,
-		`CREATE TABLE IF NOT EXISTS performers (
-			id_performer INTEGER PRIMARY KEY,
-			id_type INTEGER,
-			name TEXT,
-			FOREIGN KEY (id_type) REFERENCES types(id_type)
-		);`,
-		`CREATE TABLE IF NOT EXISTS persons (
-			id_person INTEGER PRIMARY KEY,
-			stage_name TEXT,
-			real_name TEXT,
-			birth_date TEXT,
-			death_date TEXT
-		);`,
-		`CREATE TABLE IF NOT EXISTS groups (
-			id_group INTEGER PRIMARY KEY,
-			name TEXT,
-			start_date TEXT,
-			end_date TEXT
-		);`,
-		`CREATE TABLE IF NOT EXISTS in_group (
-			id_person INTEGER,
-			id_group INTEGER,
-			PRIMARY KEY (id_person, id_group),
-			FOREIGN KEY (id_person) REFERENCES persons(id_person),
-			FOREIGN KEY (id_group) REFERENCES groups(id_group)
-		);`,
-		`CREATE TABLE IF NOT EXISTS albums (
-			id_album INTEGER PRIMARY KEY,
-			path TEXT,
-			name TEXT,
-			year INTEGER
-		);`,
-		`CREATE TABLE IF NOT EXISTS rolas (
-			id_rola INTEGER PRIMARY KEY,
-			id_performer INTEGER,
-			id_album INTEGER,
-			path TEXT,
-			title TEXT,
-			track INTEGER,
-			year INTEGER,
-			genre TEXT,
-			FOREIGN KEY (id_performer) REFERENCES performers(id_performer),
-			FOREIGN KEY (id_album) REFERENCES albums(id_album)
-		);`,
-	}
-
-	for _, query := range tableCreationQueries {
-		if _, err := db.Exec(query); err != nil {
-			return err
-		}
+// OpenDataBase opens the database stored in the given file and applies any pending migrations.
+// The database is journaled in WAL mode, so it can be read while a batch is written, and
+// transactions take the write lock as they begin, waiting up to five seconds for it.
+func OpenDataBase(dbFile string) (*DataBase, error) {
+	database, err := sql.Open("sqlite3", dbFile+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(database); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	searchIndex, err := setupSearchIndex(database)
+	if err != nil {
+		database.Close()
+		return nil, err
 	}
 
-	return nil
+	return &DataBase{Db: database, searchIndex: searchIndex, statements: &statementCache{}}, nil
 }
 
-// InsertSong adds a new song to the 'rolas' table.
+// InsertSong adds a new song to the 'rolas' table and sets its ID. Empty texts and zero
+// numbers and IDs are stored as NULL, since the song's file does not have them.
 func (db *DataBase) InsertSong(song *Song) error {
-	query := `INSERT INTO rolas (id_performer, id_album, path, title, track, year, genre) 
-              VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err := db.Db.Exec(query, song.PerformerID, song.AlbumID, song.Path, song.Title, song.Track, song.Year, song.Genre)
+	query := `INSERT INTO rolas (id_performer, id_album, path, title, track, year, genre, format, disc, comment, cover,
+			duration_ms, bitrate, sample_rate, channels, vbr, encoder) 
+              VALUES (NULLIF(?, 0), NULLIF(?, 0), ?, NULLIF(?, ''), NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''),
+			NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, ''), ?, NULLIF(?, ''))`
+	result, err := db.execPrepared(query, song.PerformerID, song.AlbumID, song.Path, song.Title, song.Track, song.Year, song.Genre, song.Format,
+		max(song.Disc, 1), song.Comment, song.Cover,
+		song.Duration.Milliseconds(), song.Bitrate, song.SampleRate, song.Channels, song.VBR, song.Encoder)
+	if err != nil {
+		return err
+	}
+	song.ID, err = result.LastInsertId()
 	return err
 }
 
-// InsertPerformer adds a new performer to the 'performers' table.
+// InsertPerformer adds a new performer to the 'performers' table and sets its ID.
 func (db *DataBase) InsertPerformer(performer *Performer) error {
 	query := `INSERT INTO performers (id_type, name) 
               VALUES (?, ?)`
-	_, err := db.Db.Exec(query, performer.Type, performer.Name)
+	result, err := db.execPrepared(query, performer.Type, performer.Name)
+	if err != nil {
+		return err
+	}
+	performer.ID, err = result.LastInsertId()
 	return err
 }
 
-// InsertAlbum adds a new album to the 'albums' table.
+// InsertAlbum adds a new album to the 'albums' table and sets its ID.
 func (db *DataBase) InsertAlbum(album *Album) error {
 	query := `INSERT INTO albums (path, name, year) 
               VALUES (?, ?, ?)`
-	_, err := db.Db.Exec(query, album.Path, album.Name, album.Year)
+	result, err := db.conn().Exec(query, album.Path, album.Name, album.Year)
+	if err != nil {
+		return err
+	}
+	album.ID, err = result.LastInsertId()
 	return err
 }
 
 // GetSongID returns the ID of a song according to its data.
 func (db *DataBase) GetSongID(performer, album int64, path, title, genre  string, track , year int) (int64, error) {
 	var id int64
-	query := `SELECT id_rola FROM rolas WHERE id_performer = ? AND id_album = ? AND path = ? AND title = ? AND track = ? AND year = ? AND genre = ?`
-    err := db.Db.QueryRow(query, performer, album, path, title, track, year, genre).Scan(&id)
+	query := `SELECT id_rola FROM rolas WHERE id_performer IS NULLIF(?, 0) AND id_album IS NULLIF(?, 0) AND path = ?
+		AND title IS NULLIF(?, '') AND track IS NULLIF(?, 0) AND year IS NULLIF(?, 0) AND genre IS NULLIF(?, '')`
+    err := db.conn().QueryRow(query, performer, album, path, title, track, year, genre).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// GetSongIDByPath returns the ID of the song stored from the given file.
+func (db *DataBase) GetSongIDByPath(path string) (int64, error) {
+	var id int64
+	err := db.queryRowPrepared(`SELECT id_rola FROM rolas WHERE path = ?`, path).Scan(&id)
 	if err == sql.ErrNoRows {
 		return 0, nil
 	}
@@ -136,7 +123,20 @@ func (db *DataBase) GetSongID(performer, album int64, path, title, genre  string
 func (db *DataBase) GetPerformerID(name string) (int64, error) {
 	var id int64
 	query := `SELECT id_performer FROM performers WHERE name = ?`
-	err := db.Db.QueryRow(query, name).Scan(&id)
+	err := db.queryRowPrepared(query, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// GetDefinedPerformerID returns the ID of a performer with the given name that is defined as
+// a person or a group, or 0 if there is none.
+func (db *DataBase) GetDefinedPerformerID(name string) (int64, error) {
+	var id int64
+	query := `SELECT id_performer FROM performers WHERE name = ? AND (id_person IS NOT NULL OR id_group IS NOT NULL)
+		ORDER BY id_performer LIMIT 1`
+	err := db.queryRowPrepared(query, name).Scan(&id)
 	if err == sql.ErrNoRows {
 		return 0, nil
 	}
@@ -147,7 +147,7 @@ func (db *DataBase) GetPerformerID(name string) (int64, error) {
 func (db *DataBase) GetAlbumID(album string, year int) (int64, error) {
 	var id int64
 	query := `SELECT id_album FROM albums WHERE name = ? AND year = ?`
-	err := db.Db.QueryRow(query, album, year).Scan(&id)
+	err := db.conn().QueryRow(query, album, year).Scan(&id)
 	if err == sql.ErrNoRows {
 		return 0, nil
 	}
@@ -157,8 +157,8 @@ func (db *DataBase) GetAlbumID(album string, year int) (int64, error) {
 // InsertSongIfNotExists inserts a song only if it does not already exist in the database.
 func (db *DataBase) InsertSongIfNotExists(performer, album int64, path, title, genre  string, track , year int) (int64, error) {
     id, err := db.GetSongID(performer, album, path, title, genre, track, year)
-    if err == nil && id != 0 {
-        return id, nil
+    if err != nil || id != 0 {
+        return id, err
     }
 
     song := Song{
@@ -174,15 +174,14 @@ func (db *DataBase) InsertSongIfNotExists(performer, album int64, path, title, g
     if err != nil {
         return 0, err
     }
-    song.ID, err = db.GetSongID(song.PerformerID, song.AlbumID, song.Path, song.Title, song.Genre, song.Track, song.Year)
     return song.ID, nil
 }
 
 // InsertPerformerIfNotExists inserts a performer only if they do not already exist in the database.
 func (db *DataBase) InsertPerformerIfNotExists(name string, performerType int) (int64, error) {
 	id, err := db.GetPerformerID(name)
-	if err == nil && id != 0 {
-		return id, nil
+	if err != nil || id != 0 {
+		return id, err
 	}
 
 	performer := Performer{
@@ -193,15 +192,14 @@ func (db *DataBase) InsertPerformerIfNotExists(name string, performerType int) (
 	if err != nil {
 		return 0, err
 	}
-	performer.ID, err = db.GetPerformerID(performer.Name)
 	return performer.ID, nil
 }
 
 // InsertAlbumIfNotExists inserts an album only if it does not already exist in the database.
 func (db *DataBase) InsertAlbumIfNotExists(name string, year int, path string) (int64, error) {
 	id, err := db.GetAlbumID(name, year)
-	if err == nil && id != 0 {
-		return id, nil
+	if err != nil || id != 0 {
+		return id, err
 	}
 
 	album := Album{
@@ -213,14 +211,13 @@ func (db *DataBase) InsertAlbumIfNotExists(name string, year int, path string) (
 	if err != nil {
 		return 0, err
 	}
-	album.ID, err = db.GetAlbumID(album.Name, album.Year)
 	return album.ID, nil
 }
 
 // GetPerformerName returns the name of a performer by their ID.
 func (db *DataBase) GetPerformerName(performerID int64) (string, error) {
 	var name string
-	err := db.Db.QueryRow("SELECT name FROM performers WHERE id_performer = ?", performerID).Scan(&name)
+	err := db.conn().QueryRow("SELECT name FROM performers WHERE id_performer = ?", performerID).Scan(&name)
 	if err != nil {
 		return "", err
 	}
@@ -230,7 +227,7 @@ func (db *DataBase) GetPerformerName(performerID int64) (string, error) {
 // GetAlbumName returns the name of an album by its ID.
 func (db *DataBase) GetAlbumName(albumID int64) (string, error) {
 	var name string
-	err := db.Db.QueryRow("SELECT name FROM albums WHERE id_album = ?", albumID).Scan(&name)
+	err := db.conn().QueryRow("SELECT name FROM albums WHERE id_album = ?", albumID).Scan(&name)
 	if err != nil {
 		return "", err
 	}
@@ -239,45 +236,67 @@ func (db *DataBase) GetAlbumName(albumID int64) (string, error) {
 
 // UpdateSong updates the details of a song in the 'rolas' table.
 func (db *DataBase) UpdateSong(idRola int64, newTitle, newGenre string, newTrack, newYear int) error {
-	query := `UPDATE rolas SET title = ?, track = ?, year = ?, genre = ? WHERE id_rola = ?`
-	_, err := db.Db.Exec(query, newTitle, newTrack, newYear, newGenre, idRola)
+	query := `UPDATE rolas SET title = NULLIF(?, ''), track = NULLIF(?, 0), year = NULLIF(?, 0), genre = NULLIF(?, '') WHERE id_rola = ?`
+	_, err := db.conn().Exec(query, newTitle, newTrack, newYear, newGenre, idRola)
+	return err
+}
+
+// UpdateSongMetadata replaces the performer, album, tags and format of an existing song with
+// the ones mined again from its file.
+func (db *DataBase) UpdateSongMetadata(song *Song) error {
+	query := `UPDATE rolas SET id_performer = NULLIF(?, 0), id_album = NULLIF(?, 0), title = NULLIF(?, ''), track = NULLIF(?, 0),
+		year = NULLIF(?, 0), genre = NULLIF(?, ''), format = NULLIF(?, ''), disc = ?, comment = NULLIF(?, ''), cover = NULLIF(?, ''),
+		duration_ms = NULLIF(?, 0), bitrate = NULLIF(?, 0), sample_rate = NULLIF(?, 0), channels = NULLIF(?, ''), vbr = ?,
+		encoder = NULLIF(?, '') WHERE id_rola = ?`
+	_, err := db.execPrepared(query, song.PerformerID, song.AlbumID, song.Title, song.Track, song.Year, song.Genre, song.Format,
+		max(song.Disc, 1), song.Comment, song.Cover,
+		song.Duration.Milliseconds(), song.Bitrate, song.SampleRate, song.Channels, song.VBR, song.Encoder, song.ID)
 	return err
 }
 
 // UpdateAlbum updates the details of an album in the 'albums' table.
 func (db *DataBase) UpdateAlbum(idAlbum int64, newName string, newYear int) error {
 	query := `UPDATE albums SET name = ?, year = ? WHERE id_album = ?`
-	_, err := db.Db.Exec(query, newName,newYear, idAlbum)
+	_, err := db.conn().Exec(query, newName,newYear, idAlbum)
 	return err
 }
 
 // UpdatePerformer updates the details of a performer in the 'performers' table.
 func (db *DataBase) UpdatePerformer(idPerformer int64, typePerf int, newName string) error {
 	query := `UPDATE performers SET id_type = ?, name = ? WHERE id_performer = ?`
-	_, err := db.Db.Exec(query, typePerf, newName, idPerformer)
+	_, err := db.conn().Exec(query, typePerf, newName, idPerformer)
 	return err
 }
 
 // UpdateNamePerformer updates the name of a performer in the 'performers' table.
 func (db *DataBase) UpdateNamePerformer(idPerformer int64, newName string) error {
 	query := `UPDATE performers SET name = ? WHERE id_performer = ?`
-	_, err := db.Db.Exec(query, newName, idPerformer)
+	_, err := db.conn().Exec(query, newName, idPerformer)
 	return err
 }
 
 // DefinePerson inserts a new person into the 'persons' table.
 func (db *DataBase) DefinePerson(stageName, realName, birthDate, deathDate string) error {
+	_, err := db.insertPerson(stageName, realName, birthDate, deathDate)
+	return err
+}
+
+// insertPerson adds a new person to the 'persons' table and returns its ID.
+func (db *DataBase) insertPerson(stageName, realName, birthDate, deathDate string) (int64, error) {
 	query := `INSERT INTO persons (stage_name, real_name, birth_date, death_date) 
               VALUES (?, ?, ?, ?)`
-	_, err := db.Db.Exec(query, stageName, realName, birthDate, deathDate)
-	return err
+	result, err := db.conn().Exec(query, stageName, realName, birthDate, deathDate)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
 }
 
 // GetPersonID returns the ID of a person based on their details.
 func (db *DataBase) GetPersonID(stageName, realName, birthDate, deathDate string) (int64, error) {
 	var id int64
 	query := `SELECT id_person FROM persons WHERE stage_name = ? AND real_name = ? AND birth_date = ? AND death_date = ?`
-	err := db.Db.QueryRow(query, stageName, realName, birthDate, deathDate).Scan(&id)
+	err := db.conn().QueryRow(query, stageName, realName, birthDate, deathDate).Scan(&id)
 	if err == sql.ErrNoRows {
 		return 0, nil
 	}
@@ -287,31 +306,35 @@ func (db *DataBase) GetPersonID(stageName, realName, birthDate, deathDate string
 // InsertPersonIfNotExists inserts a person only if they do not already exist in the database.
 func (db *DataBase) InsertPersonIfNotExists(stageName, realName, birthDate, deathDate string) (int64, error) {
 	id, err := db.GetPersonID(stageName, realName, birthDate, deathDate)
-	if err == nil && id != 0 {
-		return id, nil
+	if err != nil || id != 0 {
+		return id, err
 	}
 
-	err = db.DefinePerson(stageName, realName, birthDate, deathDate)
-	if err != nil {
-		return 0, err
-	}
-	personID, err := db.GetPersonID(stageName, realName, birthDate, deathDate)
-	return personID, nil
+	return db.insertPerson(stageName, realName, birthDate, deathDate)
 }
 
 // DefineGroup inserts a new group into the 'groups' table.
 func (db *DataBase) DefineGroup(name, startDate, endDate string) error {
+	_, err := db.insertGroup(name, startDate, endDate)
+	return err
+}
+
+// insertGroup adds a new group to the 'groups' table and returns its ID.
+func (db *DataBase) insertGroup(name, startDate, endDate string) (int64, error) {
 	query := `INSERT INTO groups (name, start_date, end_date) 
               VALUES (?, ?, ?)`
-	_, err := db.Db.Exec(query, name, startDate, endDate)
-	return err
+	result, err := db.conn().Exec(query, name, startDate, endDate)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
 }
 
 // GetGroupID returns the ID of a group based on its details.
 func (db *DataBase) GetGroupID(name, startDate, endDate string) (int64, error) {
 	var id int64
 	query := `SELECT id_group FROM groups WHERE name = ? AND start_date = ? AND end_date = ?`
-	err := db.Db.QueryRow(query, name, startDate, endDate).Scan(&id)
+	err := db.conn().QueryRow(query, name, startDate, endDate).Scan(&id)
 	if err == sql.ErrNoRows {
 		return 0, nil
 	}
@@ -321,23 +344,18 @@ func (db *DataBase) GetGroupID(name, startDate, endDate string) (int64, error) {
 // InsertGroupIfNotExists inserts a group only if it does not already exist in the database.
 func (db *DataBase) InsertGroupIfNotExists(name, startDate, endDate string) (int64, error) {
 	id, err := db.GetGroupID(name, startDate, endDate)
-	if err == nil && id != 0 {
-		return id, nil
+	if err != nil || id != 0 {
+		return id, err
 	}
 
-	err = db.DefineGroup(name, startDate, endDate)
-	if err != nil {
-		return 0, err
-	}
-	groupID, err := db.GetGroupID(name, startDate, endDate)
-	return groupID, nil
+	return db.insertGroup(name, startDate, endDate)
 }
 
 // GetGroupIDByName returns the ID of a group based on its name.
 func (db *DataBase) GetGroupIDByName(name string) (int64, error) {
 	var id int64
 	query := `SELECT id_group FROM groups WHERE name = ?`
-	err := db.Db.QueryRow(query, name).Scan(&id)
+	err := db.conn().QueryRow(query, name).Scan(&id)
 	if err == sql.ErrNoRows {
 		return 0, nil
 	}
@@ -347,146 +365,183 @@ func (db *DataBase) GetGroupIDByName(name string) (int64, error) {
 // InsertPersonInGroup adds a person to a group in the 'in_group' table.
 func (db *DataBase) InsertPersonInGroup(personID int64, groupID int64) error {
 	query := `INSERT INTO in_group (id_person, id_group) VALUES (?, ?)`
-	_, err := db.Db.Exec(query, personID, groupID)
+	_, err := db.conn().Exec(query, personID, groupID)
 	return err
 }
 
-// SearchByTitle searches for songs by their title.
-func (db *DataBase) SearchByTitle(title string) ([]Song, error) {
-	var songs []Song
-	rows, err := db.Db.Query(`SELECT * FROM rolas WHERE title LIKE ?`, "%"+title+"%")
-	if err != nil {
-		return nil, err
+// GetPerformer returns a performer by its ID.
+func (db *DataBase) GetPerformer(performerID int64) (Performer, error) {
+	performer := Performer{ID: performerID}
+	query := `SELECT IFNULL(id_type, 2), IFNULL(name, '') FROM performers WHERE id_performer = ?`
+	err := db.conn().QueryRow(query, performerID).Scan(&performer.Type, &performer.Name)
+	return performer, err
+}
+
+// LinkPerson defines a performer as the given person.
+func (db *DataBase) LinkPerson(performerID, personID int64) error {
+	query := `UPDATE performers SET id_type = 0, id_person = ?, id_group = NULL WHERE id_performer = ?`
+	_, err := db.conn().Exec(query, personID, performerID)
+	return err
+}
+
+// LinkGroup defines a performer as the given group.
+func (db *DataBase) LinkGroup(performerID, groupID int64) error {
+	query := `UPDATE performers SET id_type = 1, id_group = ?, id_person = NULL WHERE id_performer = ?`
+	_, err := db.conn().Exec(query, groupID, performerID)
+	return err
+}
+
+// GetPersonByPerformer returns the person a performer is defined as. It reports false when
+// the performer is not linked to a person.
+func (db *DataBase) GetPersonByPerformer(performerID int64) (Person, bool, error) {
+	var person Person
+	query := `SELECT s.id_person, IFNULL(s.stage_name, ''), IFNULL(s.real_name, ''), IFNULL(s.birth_date, ''), IFNULL(s.death_date, '')
+		FROM performers p JOIN persons s ON s.id_person = p.id_person WHERE p.id_performer = ?`
+	err := db.conn().QueryRow(query, performerID).Scan(&person.ID, &person.StageName, &person.RealName, &person.BirthDate, &person.DeathDate)
+	if err == sql.ErrNoRows {
+		return Person{}, false, nil
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var song Song
-		if err := rows.Scan(&song.ID, &song.PerformerID, &song.AlbumID, &song.Path, &song.Title, &song.Track, &song.Year, &song.Genre); err != nil {
-			return nil, err
-		}
-		performerName, err := db.GetPerformerName(song.PerformerID)
-		if err != nil {
-			return nil, err
-		}
-		albumName, err := db.GetAlbumName(song.AlbumID)
-		if err != nil {
-			return nil, err
-		}
-		song.PerformerName = performerName
-		song.AlbumName = albumName
-		songs = append(songs, song)
+	return person, err == nil, err
+}
+
+// GetGroupByPerformer returns the group a performer is defined as. It reports false when the
+// performer is not linked to a group.
+func (db *DataBase) GetGroupByPerformer(performerID int64) (Group, bool, error) {
+	var group Group
+	query := `SELECT g.id_group, IFNULL(g.name, ''), IFNULL(g.start_date, ''), IFNULL(g.end_date, '')
+		FROM performers p JOIN groups g ON g.id_group = p.id_group WHERE p.id_performer = ?`
+	err := db.conn().QueryRow(query, performerID).Scan(&group.ID, &group.Name, &group.StartDate, &group.EndDate)
+	if err == sql.ErrNoRows {
+		return Group{}, false, nil
 	}
-	return songs, nil
+	return group, err == nil, err
 }
 
-// SearchByPerformer searches for songs by the performer's name.
-func (db *DataBase) SearchByPerformer(performer string) ([]Song, error) {
-	var songs []Song
-	rows, err := db.Db.Query(`SELECT * FROM rolas WHERE id_performer IN (SELECT id_performer FROM performers WHERE name LIKE ?)`, "%"+performer+"%")
+// GetGroupsOfPerson returns the groups a person is a member of, by name.
+func (db *DataBase) GetGroupsOfPerson(personID int64) ([]Group, error) {
+	query := `SELECT DISTINCT g.id_group, IFNULL(g.name, ''), IFNULL(g.start_date, ''), IFNULL(g.end_date, '')
+		FROM in_group i JOIN groups g ON g.id_group = i.id_group WHERE i.id_person = ? ORDER BY g.name`
+	rows, err := db.conn().Query(query, personID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
+	var groups []Group
 	for rows.Next() {
-		var song Song
-		if err := rows.Scan(&song.ID, &song.PerformerID, &song.AlbumID, &song.Path, &song.Title, &song.Track, &song.Year, &song.Genre); err != nil {
+		var group Group
+		if err := rows.Scan(&group.ID, &group.Name, &group.StartDate, &group.EndDate); err != nil {
 			return nil, err
 		}
-		performerName, err := db.GetPerformerName(song.PerformerID)
-		if err != nil {
-			return nil, err
-		}
-		albumName, err := db.GetAlbumName(song.AlbumID)
-		if err != nil {
-			return nil, err
-		}
-		song.PerformerName = performerName
-		song.AlbumName = albumName
-		songs = append(songs, song)
+		groups = append(groups, group)
 	}
-	return songs, nil
+	return groups, rows.Err()
 }
 
-// SearchByAlbum searches for songs by the album's name.
-func (db *DataBase) SearchByAlbum(album string) ([]Song, error) {
-	var songs []Song
-	rows, err := db.Db.Query(`SELECT * FROM rolas WHERE id_album IN (SELECT id_album FROM albums WHERE name LIKE ?)`, "%"+album+"%")
+// UpdatePerson updates the details of a person in the 'persons' table.
+func (db *DataBase) UpdatePerson(person *Person) error {
+	query := `UPDATE persons SET stage_name = ?, real_name = ?, birth_date = ?, death_date = ? WHERE id_person = ?`
+	_, err := db.conn().Exec(query, person.StageName, person.RealName, person.BirthDate, person.DeathDate, person.ID)
+	return err
+}
+
+// UpdateGroup updates the details of a group in the 'groups' table.
+func (db *DataBase) UpdateGroup(group *Group) error {
+	query := `UPDATE groups SET name = ?, start_date = ?, end_date = ? WHERE id_group = ?`
+	_, err := db.conn().Exec(query, group.Name, group.StartDate, group.EndDate, group.ID)
+	return err
+}
+
+// songsFrom is the FROM clause of the song queries, where 'rolas' is aliased as r,
+// 'performers' as p, 'albums' as a and the performer credited as album artist as aa.
+const songsFrom = `FROM rolas r
+		LEFT JOIN performers p ON p.id_performer = r.id_performer
+		LEFT JOIN albums a ON a.id_album = r.id_album
+		LEFT JOIN performers aa ON aa.id_performer = a.id_performer`
+
+// songColumns selects a song with its performer, album and credits, in the order read by
+// scanSong. Missing values are read as empty texts and zeros.
+const songColumns = `SELECT r.id_rola, IFNULL(r.id_performer, 0), IFNULL(r.id_album, 0), r.path, IFNULL(r.title, ''),
+		IFNULL(r.track, 0), IFNULL(r.year, 0), IFNULL(r.genre, ''), r.missing, IFNULL(r.format, ''),
+		r.disc, IFNULL(r.comment, ''), IFNULL(` + composerNames + `, ''), IFNULL(` + artistNames + `, ''),
+		IFNULL(` + featuredNames + `, ''), IFNULL(r.duration_ms, 0), IFNULL(r.bitrate, 0),
+		IFNULL(r.sample_rate, 0), IFNULL(r.channels, ''), r.vbr, IFNULL(r.encoder, ''),
+		IFNULL(p.name, ''), IFNULL(p.id_type, 2), IFNULL(a.name, ''), IFNULL(a.path, ''), IFNULL(a.year, 0),
+		IFNULL(a.id_performer, 0), IFNULL(aa.name, ''), IFNULL(r.cover, ''), IFNULL(a.cover, '') `
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSong reads a song selected with songColumns.
+func scanSong(row rowScanner) (Song, error) {
+	var song Song
+	var duration int64
+	err := row.Scan(&song.ID, &song.PerformerID, &song.AlbumID, &song.Path, &song.Title, &song.Track, &song.Year, &song.Genre, &song.Missing, &song.Format,
+		&song.Disc, &song.Comment, &song.Composer, &song.Artists, &song.Featured, &duration, &song.Bitrate, &song.SampleRate, &song.Channels, &song.VBR, &song.Encoder,
+		&song.PerformerName, &song.PerformerType, &song.AlbumName, &song.AlbumPath, &song.AlbumYear,
+		&song.AlbumArtistID, &song.AlbumArtistName, &song.Cover, &song.AlbumCover)
+	song.Duration = time.Duration(duration) * time.Millisecond
+	return song, err
+}
+
+// querySongs runs a query built on songColumns and songsFrom and returns every song read.
+func (db *DataBase) querySongs(query string, args ...interface{}) ([]Song, error) {
+	rows, err := db.conn().Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
+	var songs []Song
 	for rows.Next() {
-		var song Song
-		if err := rows.Scan(&song.ID, &song.PerformerID, &song.AlbumID, &song.Path, &song.Title, &song.Track, &song.Year, &song.Genre); err != nil {
-			return nil, err
-		}
-		performerName, err := db.GetPerformerName(song.PerformerID)
-		if err != nil {
-			return nil, err
-		}
-		albumName, err := db.GetAlbumName(song.AlbumID)
+		song, err := scanSong(rows)
 		if err != nil {
 			return nil, err
 		}
-		song.PerformerName = performerName
-		song.AlbumName = albumName
 		songs = append(songs, song)
 	}
-	return songs, nil
+	return songs, rows.Err()
+}
+
+// GetAllSongs returns every song in the database with its performer and album.
+func (db *DataBase) GetAllSongs() ([]Song, error) {
+	return db.querySongs(songColumns + songsFrom + ` ORDER BY r.id_rola`)
+}
+
+// GetSong returns a song by its ID with its performer and album.
+func (db *DataBase) GetSong(songID int64) (Song, error) {
+	return scanSong(db.conn().QueryRow(songColumns+songsFrom+` WHERE r.id_rola = ?`, songID))
+}
+
+// GetAlbumSongs returns the songs of an album with their performer and album.
+func (db *DataBase) GetAlbumSongs(albumID int64) ([]Song, error) {
+	return db.querySongs(songColumns+songsFrom+` WHERE r.id_album = ? ORDER BY r.disc, r.track`, albumID)
+}
+
+// SearchByTitle searches for songs by their title.
+func (db *DataBase) SearchByTitle(title string) ([]Song, error) {
+	return db.querySongs(songColumns+songsFrom+` WHERE r.title LIKE ?`, "%"+title+"%")
+}
+
+// SearchByPerformer searches for songs by the name of any of their artists, including the
+// featured ones.
+func (db *DataBase) SearchByPerformer(performer string) ([]Song, error) {
+	return db.querySongs(songColumns+songsFrom+` WHERE `+performerNames+` LIKE ?`, "%"+performer+"%")
+}
+
+// SearchByAlbum searches for songs by the album's name.
+func (db *DataBase) SearchByAlbum(album string) ([]Song, error) {
+	return db.querySongs(songColumns+songsFrom+` WHERE a.name LIKE ?`, "%"+album+"%")
 }
 
 // SearchByYear searches for songs by year.
 func (db *DataBase) SearchByYear(year int) ([]Song, error) {
-	var songs []Song
-	rows, err := db.Db.Query(`SELECT * FROM rolas WHERE year = ?`, year)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var song Song
-		if err := rows.Scan(&song.ID, &song.PerformerID, &song.AlbumID, &song.Path, &song.Title, &song.Track, &song.Year, &song.Genre); err != nil {
-			return nil, err
-		}
-		performerName, err := db.GetPerformerName(song.PerformerID)
-		if err != nil {
-			return nil, err
-		}
-		albumName, err := db.GetAlbumName(song.AlbumID)
-		if err != nil {
-			return nil, err
-		}
-		song.PerformerName = performerName
-		song.AlbumName = albumName
-		songs = append(songs, song)
-	}
-	return songs, nil
+	return db.querySongs(songColumns+songsFrom+` WHERE r.year = ?`, year)
 }
 
 // SearchByGenre searches for songs by genre.
 func (db *DataBase) SearchByGenre(genre string) ([]Song, error) {
-	var songs []Song
-	rows, err := db.Db.Query(`SELECT * FROM rolas WHERE genre LIKE ?`, "%"+genre+"%")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var song Song
-		if err := rows.Scan(&song.ID, &song.PerformerID, &song.AlbumID, &song.Path, &song.Title, &song.Track, &song.Year, &song.Genre); err != nil {
-			return nil, err
-		}
-		performerName, err := db.GetPerformerName(song.PerformerID)
-		if err != nil {
-			return nil, err
-		}
-		albumName, err := db.GetAlbumName(song.AlbumID)
-		if err != nil {
-			return nil, err
-		}
-		song.PerformerName = performerName
-		song.AlbumName = albumName
-		songs = append(songs, song)
-	}
-	return songs, nil
-}
\ No newline at end of file
+	return db.querySongs(songColumns+songsFrom+` WHERE r.genre LIKE ?`, "%"+genre+"%")
+}
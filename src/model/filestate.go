@@ -0,0 +1,166 @@
+package model
+
+import (
+	"io"
+	"os"
+	"strings"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+)
+
+// FileState is the size, modification time and content hash a song's file had when it was
+// last mined, and whether the file is missing from the music directory.
+type FileState struct {
+	SongID int64
+	Size int64
+	ModTime int64
+	Hash string
+	Missing bool
+}
+
+// Matches reports whether the file still has the recorded size and modification time.
+func (state FileState) Matches(info os.FileInfo) bool {
+	return state.Size == info.Size() && state.ModTime == info.ModTime().UnixNano()
+}
+
+// HashFile returns the hex encoded SHA-256 of the file's content.
+func HashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fileStateColumns selects a song's file state in the order read by scanFileState.
+const fileStateColumns = `SELECT id_rola, IFNULL(size, -1), IFNULL(mtime, 0), IFNULL(hash, ''), missing FROM rolas `
+
+// scanFileState reads a file state selected with fileStateColumns. Songs mined before file
+// states were recorded get a size of -1, so they never match their file.
+func scanFileState(row rowScanner) (FileState, error) {
+	var state FileState
+	err := row.Scan(&state.SongID, &state.Size, &state.ModTime, &state.Hash, &state.Missing)
+	return state, err
+}
+
+// GetFileStates returns the recorded state of the file of every song, keyed by path.
+func (db *DataBase) GetFileStates() (map[string]FileState, error) {
+	rows, err := db.conn().Query(`SELECT path, id_rola, IFNULL(size, -1), IFNULL(mtime, 0), IFNULL(hash, ''), missing FROM rolas`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]FileState)
+	for rows.Next() {
+		var path string
+		var state FileState
+		if err := rows.Scan(&path, &state.SongID, &state.Size, &state.ModTime, &state.Hash, &state.Missing); err != nil {
+			return nil, err
+		}
+		states[path] = state
+	}
+	return states, rows.Err()
+}
+
+// GetFileState returns the recorded state of a file, and false if no song comes from it.
+func (db *DataBase) GetFileState(path string) (FileState, bool, error) {
+	state, err := scanFileState(db.queryRowPrepared(fileStateColumns+`WHERE path = ?`, path))
+	if err == sql.ErrNoRows {
+		return FileState{}, false, nil
+	}
+	return state, err == nil, err
+}
+
+// SetFileState records the size, modification time and hash of a song's file, which is
+// therefore present.
+func (db *DataBase) SetFileState(songID int64, info os.FileInfo, hash string) error {
+	query := `UPDATE rolas SET size = ?, mtime = ?, hash = ?, missing = 0 WHERE id_rola = ?`
+	_, err := db.execPrepared(query, info.Size(), info.ModTime().UnixNano(), hash, songID)
+	return err
+}
+
+// SetMissing flags whether the file of a song is missing from the music directory.
+func (db *DataBase) SetMissing(songID int64, missing bool) error {
+	_, err := db.execPrepared(`UPDATE rolas SET missing = ? WHERE id_rola = ?`, missing, songID)
+	return err
+}
+
+// MarkMissingUnder flags as missing the song whose file is path and the songs whose file is
+// inside the directory path, and returns how many songs were flagged.
+func (db *DataBase) MarkMissingUnder(path string) (int64, error) {
+	prefix := strings.TrimSuffix(path, string(os.PathSeparator)) + string(os.PathSeparator)
+	// The paths inside the directory sort between the prefix and the prefix with its last
+	// byte incremented, comparing bytes so any name matches.
+	end := prefix[:len(prefix)-1] + string(rune(os.PathSeparator+1))
+	query := `UPDATE rolas SET missing = 1 WHERE missing = 0 AND (path = ? OR (path >= ? AND path < ?))`
+	result, err := db.conn().Exec(query, path, prefix, end)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// FindMissingSong returns the ID of a song whose file is missing and had the given hash,
+// or 0 if there is none.
+func (db *DataBase) FindMissingSong(hash string) (int64, error) {
+	var id int64
+	query := `SELECT id_rola FROM rolas WHERE missing = 1 AND hash = ? ORDER BY id_rola LIMIT 1`
+	err := db.queryRowPrepared(query, hash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// songAlbumID returns the ID of the album of a song, or 0 if it has none.
+func (db *DataBase) songAlbumID(songID int64) (int64, error) {
+	var id int64
+	err := db.queryRowPrepared(`SELECT IFNULL(id_album, 0) FROM rolas WHERE id_rola = ?`, songID).Scan(&id)
+	return id, err
+}
+
+// MoveSong changes the file a song comes from, keeping the rest of its data.
+func (db *DataBase) MoveSong(songID int64, path string) error {
+	_, err := db.execPrepared(`UPDATE rolas SET path = ? WHERE id_rola = ?`, path, songID)
+	return err
+}
+
+// DeleteMissingSongs deletes the songs whose file is missing and returns how many were deleted.
+func (db *DataBase) DeleteMissingSongs() (int64, error) {
+	result, err := db.conn().Exec(`DELETE FROM rolas WHERE missing = 1`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteOrphans deletes the albums left without songs and the performers left without songs,
+// albums or credits, and returns how many rows were deleted.
+func (db *DataBase) DeleteOrphans() (int64, error) {
+	var deleted int64
+	for _, query := range []string{
+		`DELETE FROM albums WHERE id_album NOT IN (SELECT id_album FROM rolas WHERE id_album IS NOT NULL)`,
+		`DELETE FROM performers WHERE id_performer NOT IN (SELECT id_performer FROM rolas WHERE id_performer IS NOT NULL)
+			AND id_performer NOT IN (SELECT id_performer FROM albums WHERE id_performer IS NOT NULL)
+			AND id_performer NOT IN (SELECT id_performer FROM credits)`,
+	} {
+		result, err := db.conn().Exec(query)
+		if err != nil {
+			return deleted, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += rows
+	}
+	return deleted, nil
+}
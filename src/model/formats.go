@@ -0,0 +1,105 @@
+package model
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// AudioFormat describes a kind of audio file the miner can read. Files are found by their
+// extensions, and Sniff recognizes the format from the first bytes of a file, so a file with
+// the wrong extension still gets its real format.
+type AudioFormat struct {
+	Name       string
+	Extensions []string
+	Sniff      func(header []byte) bool
+}
+
+// sniffLength is the number of bytes read from a file to recognize its format.
+const sniffLength = 64
+
+// DefaultFormats returns the formats the tag library can read metadata from.
+func DefaultFormats() []AudioFormat {
+	return []AudioFormat{
+		{Name: "mp3", Extensions: []string{".mp3"}, Sniff: isMP3},
+		{Name: "flac", Extensions: []string{".flac"}, Sniff: isFLAC},
+		{Name: "vorbis", Extensions: []string{".ogg", ".oga"}, Sniff: isOggStream("\x01vorbis")},
+		{Name: "opus", Extensions: []string{".opus"}, Sniff: isOggStream("OpusHead")},
+		{Name: "m4a", Extensions: []string{".m4a", ".m4b", ".mp4"}, Sniff: isMP4},
+	}
+}
+
+// isMP3 recognizes an ID3v2 tag or an MPEG audio frame header.
+func isMP3(header []byte) bool {
+	if bytes.HasPrefix(header, []byte("ID3")) {
+		return true
+	}
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0
+}
+
+// isFLAC recognizes the FLAC stream marker.
+func isFLAC(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("fLaC"))
+}
+
+// isMP4 recognizes the 'ftyp' box that starts MP4 containers.
+func isMP4(header []byte) bool {
+	return len(header) >= 8 && string(header[4:8]) == "ftyp"
+}
+
+// isOggStream returns a sniffer recognizing an Ogg container whose first packet starts with
+// the codec's identification header. The packet follows the 27 byte page header and a
+// one byte segment table.
+func isOggStream(codec string) func(header []byte) bool {
+	return func(header []byte) bool {
+		return bytes.HasPrefix(header, []byte("OggS")) && len(header) >= 28+len(codec) &&
+			string(header[28:28+len(codec)]) == codec
+	}
+}
+
+// RegisterFormat adds a format the miner looks for. Formats registered later take precedence
+// when several recognize the same extension or content.
+func (miner *Miner) RegisterFormat(format AudioFormat) {
+	miner.formats = append([]AudioFormat{format}, miner.formats...)
+}
+
+// formatByExtension returns the format registered for the file's extension, in any case.
+func (miner *Miner) formatByExtension(path string) (AudioFormat, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, format := range miner.formats {
+		for _, known := range format.Extensions {
+			if ext == known {
+				return format, true
+			}
+		}
+	}
+	return AudioFormat{}, false
+}
+
+// IsAudioFile reports whether the path names a file the miner can read.
+func (miner *Miner) IsAudioFile(path string) bool {
+	_, ok := miner.formatByExtension(path)
+	return ok
+}
+
+// DetectFormat returns the name of the format of the file whose reader is positioned at its
+// start, falling back to its extension when the content is not recognized. The reader is
+// left at the start of the file.
+func (miner *Miner) DetectFormat(path string, r io.ReadSeeker) (string, error) {
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	for _, format := range miner.formats {
+		if format.Sniff != nil && format.Sniff(header[:n]) {
+			return format.Name, nil
+		}
+	}
+	format, _ := miner.formatByExtension(path)
+	return format.Name, nil
+}
@@ -0,0 +1,9 @@
+package model
+
+// Group represents a performer made up of several persons.
+type Group struct {
+	ID int64
+	Name string
+	StartDate string
+	EndDate string
+}
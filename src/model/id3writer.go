@@ -0,0 +1,294 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ID3Tags are the tags written back into an MP3 file. Empty texts and zero numbers remove
+// the tag from the file.
+type ID3Tags struct {
+	Title  string
+	Artist string
+	Album  string
+	Year   int
+	Track  int
+	Genre  string
+}
+
+// id3Padding is the room left after the frames, so players editing the tag later do not
+// need to rewrite the file.
+const id3Padding = 1024
+
+// id3Frame is a frame of an ID3v2 tag, kept as read from the file.
+type id3Frame struct {
+	id    string
+	flags [2]byte
+	data  []byte
+}
+
+// WriteID3Tags writes the tags into the ID3v2 tag of an MP3 file, keeping the other frames of
+// the tag and the version it has. A file without an ID3v2.3 or ID3v2.4 tag gets a new tag of
+// the given version, 3 or 4. The file is replaced atomically: the new content is written to a
+// temporary file in the same directory, which is then renamed over the original.
+func WriteID3Tags(file string, tags ID3Tags, version int) error {
+	if version != 3 && version != 4 {
+		return fmt.Errorf("unsupported ID3v2 version 2.%d", version)
+	}
+	original, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer original.Close()
+	info, err := original.Stat()
+	if err != nil {
+		return err
+	}
+
+	frames, tagVersion, audioStart, err := readID3Frames(original)
+	if err != nil {
+		return fmt.Errorf("reading the ID3 tag of %s: %v", file, err)
+	}
+	if tagVersion == 3 || tagVersion == 4 {
+		version = tagVersion
+	} else {
+		frames = nil
+	}
+	frames = setID3Frames(frames, tags, version)
+	if _, err := original.Seek(audioStart, io.SeekStart); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(encodeID3Tag(frames, version)); err != nil {
+		temp.Close()
+		return err
+	}
+	if _, err := io.Copy(temp, original); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), file)
+}
+
+// id3AudioStart returns where the audio starts after the ID3v2 tag with the given 10-byte
+// header, or 0 if there is no tag.
+func id3AudioStart(header []byte) int64 {
+	if len(header) < 10 || string(header[:3]) != "ID3" {
+		return 0
+	}
+	audioStart := 10 + int64(syncsafe(header[6:10]))
+	if header[3] == 4 && header[5]&0x10 != 0 {
+		audioStart += 10
+	}
+	return audioStart
+}
+
+// readID3Frames reads the frames of the ID3v2 tag at the start of the reader. It returns the
+// major version of the tag, 0 when there is none, and the offset where the audio starts.
+// The frames of an ID3v2.2 tag are not read, since they cannot be written back.
+func readID3Frames(r io.Reader) ([]id3Frame, int, int64, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, 0, nil
+		}
+		return nil, 0, 0, err
+	}
+	if string(header[:3]) != "ID3" {
+		return nil, 0, 0, nil
+	}
+	version, flags := int(header[3]), header[5]
+	size := int64(syncsafe(header[6:10]))
+	audioStart := id3AudioStart(header)
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, 0, err
+	}
+	if version != 3 && version != 4 {
+		return nil, version, audioStart, nil
+	}
+	if version == 3 && flags&0x80 != 0 {
+		body = bytes.ReplaceAll(body, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+	if flags&0x40 != 0 && len(body) >= 4 {
+		extended := int(binary.BigEndian.Uint32(body[:4])) + 4
+		if version == 4 {
+			extended = syncsafe(body[:4])
+		}
+		if extended > len(body) {
+			return nil, 0, 0, errors.New("invalid extended header")
+		}
+		body = body[extended:]
+	}
+
+	var frames []id3Frame
+	for len(body) >= 10 && body[0] != 0 {
+		frameSize := int(binary.BigEndian.Uint32(body[4:8]))
+		if version == 4 {
+			frameSize = syncsafe(body[4:8])
+		}
+		if 10+frameSize > len(body) {
+			return nil, 0, 0, fmt.Errorf("frame %q exceeds the tag", body[:4])
+		}
+		frames = append(frames, id3Frame{
+			id:    string(body[:4]),
+			flags: [2]byte{body[8], body[9]},
+			data:  body[10 : 10+frameSize],
+		})
+		body = body[10+frameSize:]
+	}
+	return frames, version, audioStart, nil
+}
+
+// setID3Frames replaces the frames of the tags with their new values, keeping the track total
+// the file had.
+func setID3Frames(frames []id3Frame, tags ID3Tags, version int) []id3Frame {
+	yearFrame := "TDRC"
+	if version == 3 {
+		yearFrame = "TYER"
+	}
+	track := ""
+	if tags.Track != 0 {
+		track = strconv.Itoa(tags.Track)
+		for _, frame := range frames {
+			if frame.id == "TRCK" {
+				if _, total, ok := strings.Cut(decodeID3Text(frame.data), "/"); ok && total != "" {
+					track += "/" + total
+				}
+			}
+		}
+	}
+	year := ""
+	if tags.Year != 0 {
+		year = strconv.Itoa(tags.Year)
+	}
+	values := []struct{ id, text string }{
+		{"TIT2", tags.Title}, {"TPE1", tags.Artist}, {"TALB", tags.Album},
+		{yearFrame, year}, {"TRCK", track}, {"TCON", tags.Genre},
+	}
+
+	replaced := map[string]bool{"TDRC": true, "TYER": true, "TDAT": true}
+	for _, value := range values {
+		replaced[value.id] = true
+	}
+	var kept []id3Frame
+	for _, frame := range frames {
+		if !replaced[frame.id] {
+			kept = append(kept, frame)
+		}
+	}
+	for _, value := range values {
+		if value.text != "" {
+			kept = append(kept, id3Frame{id: value.id, data: encodeID3Text(value.text, version)})
+		}
+	}
+	return kept
+}
+
+// encodeID3Tag encodes the frames as an ID3v2 tag of the given version, followed by padding.
+func encodeID3Tag(frames []id3Frame, version int) []byte {
+	var body bytes.Buffer
+	for _, frame := range frames {
+		body.WriteString(frame.id)
+		size := make([]byte, 4)
+		if version == 4 {
+			putSyncsafe(size, len(frame.data))
+		} else {
+			binary.BigEndian.PutUint32(size, uint32(len(frame.data)))
+		}
+		body.Write(size)
+		body.Write(frame.flags[:])
+		body.Write(frame.data)
+	}
+	body.Write(make([]byte, id3Padding))
+
+	header := []byte{'I', 'D', '3', byte(version), 0, 0, 0, 0, 0, 0}
+	putSyncsafe(header[6:], body.Len())
+	return append(header, body.Bytes()...)
+}
+
+// encodeID3Text encodes a text frame: UTF-8 for ID3v2.4, and for ID3v2.3, which has no UTF-8,
+// ISO-8859-1 when the text is ASCII or UTF-16 with a byte order mark otherwise.
+func encodeID3Text(text string, version int) []byte {
+	if version == 4 {
+		return append([]byte{3}, text...)
+	}
+	ascii := true
+	for _, r := range text {
+		if r >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return append([]byte{0}, text...)
+	}
+	data := []byte{1, 0xFF, 0xFE}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		data = binary.LittleEndian.AppendUint16(data, unit)
+	}
+	return data
+}
+
+// decodeID3Text decodes a text frame written in any of the ID3v2 encodings.
+func decodeID3Text(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	encoding, data := data[0], data[1:]
+	switch encoding {
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+			order, data = binary.LittleEndian, data[2:]
+		} else if len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF {
+			data = data[2:]
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			units = append(units, order.Uint16(data[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	case 0:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.TrimRight(string(runes), "\x00")
+	}
+	return strings.TrimRight(string(data), "\x00")
+}
+
+// syncsafe decodes a 28 bit integer stored in 4 bytes of 7 bits.
+func syncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+// putSyncsafe encodes a 28 bit integer in 4 bytes of 7 bits.
+func putSyncsafe(b []byte, n int) {
+	b[0], b[1], b[2], b[3] = byte(n>>21&0x7F), byte(n>>14&0x7F), byte(n>>7&0x7F), byte(n&0x7F)
+}
@@ -0,0 +1,106 @@
+package model
+
+// Membership is a person's membership of a group: when they joined and left it, and their
+// role or instrument in it. Each of them is empty when unknown.
+type Membership struct {
+	PersonID int64
+	GroupID int64
+	PersonName string
+	GroupName string
+	StartDate string
+	EndDate string
+	Role string
+}
+
+// membershipColumns selects a membership, in the order read by scanMembership, from 'in_group'
+// aliased as i, joined with 'persons' as s and 'groups' as g.
+const membershipColumns = `SELECT i.id_person, i.id_group, IFNULL(s.stage_name, ''), IFNULL(g.name, ''),
+		IFNULL(i.start_date, ''), IFNULL(i.end_date, ''), IFNULL(i.role, '')
+	FROM in_group i JOIN persons s ON s.id_person = i.id_person JOIN groups g ON g.id_group = i.id_group`
+
+// AddMember adds a person to a group, or updates the dates and role of a person already in it.
+func (db *DataBase) AddMember(membership Membership) error {
+	query := `INSERT INTO in_group (id_person, id_group, start_date, end_date, role)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))
+		ON CONFLICT (id_person, id_group) DO UPDATE SET
+			start_date = excluded.start_date, end_date = excluded.end_date, role = excluded.role`
+	_, err := db.conn().Exec(query, membership.PersonID, membership.GroupID, membership.StartDate, membership.EndDate, membership.Role)
+	return err
+}
+
+// RemoveMember removes a person from a group.
+func (db *DataBase) RemoveMember(personID, groupID int64) error {
+	_, err := db.conn().Exec(`DELETE FROM in_group WHERE id_person = ? AND id_group = ?`, personID, groupID)
+	return err
+}
+
+// GetGroupMembers returns the memberships of a group, by the date the persons joined it and
+// their name.
+func (db *DataBase) GetGroupMembers(groupID int64) ([]Membership, error) {
+	return db.queryMemberships(membershipColumns+` WHERE i.id_group = ? ORDER BY i.start_date, s.stage_name`, groupID)
+}
+
+// GetPersonMemberships returns the memberships of a person, by the date they joined each group
+// and its name.
+func (db *DataBase) GetPersonMemberships(personID int64) ([]Membership, error) {
+	return db.queryMemberships(membershipColumns+` WHERE i.id_person = ? ORDER BY i.start_date, g.name`, personID)
+}
+
+// queryMemberships runs a query built on membershipColumns and returns every membership read.
+func (db *DataBase) queryMemberships(query string, args ...interface{}) ([]Membership, error) {
+	rows, err := db.conn().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []Membership
+	for rows.Next() {
+		var m Membership
+		if err := rows.Scan(&m.PersonID, &m.GroupID, &m.PersonName, &m.GroupName, &m.StartDate, &m.EndDate, &m.Role); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+// GetPersons returns every person, by stage name.
+func (db *DataBase) GetPersons() ([]Person, error) {
+	rows, err := db.conn().Query(`SELECT id_person, IFNULL(stage_name, ''), IFNULL(real_name, ''), IFNULL(birth_date, ''),
+		IFNULL(death_date, '') FROM persons ORDER BY stage_name, id_person`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var persons []Person
+	for rows.Next() {
+		var person Person
+		if err := rows.Scan(&person.ID, &person.StageName, &person.RealName, &person.BirthDate, &person.DeathDate); err != nil {
+			return nil, err
+		}
+		persons = append(persons, person)
+	}
+	return persons, rows.Err()
+}
+
+// GetGroups returns every group, by name.
+func (db *DataBase) GetGroups() ([]Group, error) {
+	rows, err := db.conn().Query(`SELECT id_group, IFNULL(name, ''), IFNULL(start_date, ''), IFNULL(end_date, '')
+		FROM groups ORDER BY name, id_group`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var group Group
+		if err := rows.Scan(&group.ID, &group.Name, &group.StartDate, &group.EndDate); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
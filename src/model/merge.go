@@ -0,0 +1,169 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MergeCandidate is a performer or album that may be a duplicate of others, with the number
+// of songs it has. Detail tells albums apart by their directory.
+type MergeCandidate struct {
+	ID int64
+	Name string
+	Detail string
+	Songs int
+}
+
+// Duplicates are candidates whose names only differ in case, punctuation or a leading "The",
+// the one with most songs first.
+type Duplicates struct {
+	Key string
+	Candidates []MergeCandidate
+}
+
+// NormalizeName folds a name to the key duplicates share: lowercase letters and digits only,
+// without a leading "The" and with "&" read as "and". "The Beatles", "Beatles" and
+// "the beatles!" are all "beatles".
+func NormalizeName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, "the ")
+	name = strings.ReplaceAll(name, "&", "and")
+	var key strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			key.WriteRune(r)
+		}
+	}
+	return key.String()
+}
+
+// groupDuplicates groups the candidates read by query, each row holding a candidate and the
+// extra text its key is made of, and returns the groups of more than one by their key.
+// Names without letters or digits are never grouped.
+func (db *DataBase) groupDuplicates(query string) ([]Duplicates, error) {
+	rows, err := db.conn().Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[string][]MergeCandidate)
+	for rows.Next() {
+		var candidate MergeCandidate
+		var extra string
+		if err := rows.Scan(&candidate.ID, &candidate.Name, &candidate.Detail, &candidate.Songs, &extra); err != nil {
+			return nil, err
+		}
+		name := NormalizeName(candidate.Name)
+		if name == "" {
+			continue
+		}
+		key := name
+		if extra != "" {
+			key += " / " + NormalizeName(extra)
+		}
+		groups[key] = append(groups[key], candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var duplicates []Duplicates
+	for key, candidates := range groups {
+		if len(candidates) < 2 {
+			continue
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].Songs != candidates[j].Songs {
+				return candidates[i].Songs > candidates[j].Songs
+			}
+			return candidates[i].ID < candidates[j].ID
+		})
+		duplicates = append(duplicates, Duplicates{Key: key, Candidates: candidates})
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Key < duplicates[j].Key
+	})
+	return duplicates, nil
+}
+
+// FindDuplicatePerformers returns the performers that are likely the same one, by their
+// normalized name.
+func (db *DataBase) FindDuplicatePerformers() ([]Duplicates, error) {
+	return db.groupDuplicates(`SELECT p.id_performer, IFNULL(p.name, ''), '',
+		(SELECT COUNT(*) FROM rolas r WHERE r.id_performer = p.id_performer), ''
+		FROM performers p ORDER BY p.id_performer`)
+}
+
+// FindDuplicateAlbums returns the albums that are likely the same one, by their normalized
+// name and the normalized name of their album artist.
+func (db *DataBase) FindDuplicateAlbums() ([]Duplicates, error) {
+	return db.groupDuplicates(`SELECT a.id_album, IFNULL(a.name, ''), IFNULL(a.path, ''),
+		(SELECT COUNT(*) FROM rolas r WHERE r.id_album = a.id_album), IFNULL(aa.name, '')
+		FROM albums a LEFT JOIN performers aa ON aa.id_performer = a.id_performer ORDER BY a.id_album`)
+}
+
+// mergeRows merges each duplicate row into the surviving one inside a transaction, checking
+// both exist with exists and running the queries with the survivor as ?1 and the duplicate
+// as ?2. Nothing changes if any of them fails.
+func (db *DataBase) mergeRows(what, exists string, survivorID int64, duplicateIDs []int64, queries ...string) error {
+	return db.transaction(func(tx *DataBase) error {
+		for _, id := range append([]int64{survivorID}, duplicateIDs...) {
+			var found int
+			err := tx.conn().QueryRow(exists, id).Scan(&found)
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("there is no %s with ID %d", what, id)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for _, id := range duplicateIDs {
+			if id == survivorID {
+				return fmt.Errorf("cannot merge %s %d into itself", what, id)
+			}
+			for _, query := range queries {
+				if _, err := tx.conn().Exec(query, survivorID, id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// MergePerformers merges the duplicate performers into the surviving one: their songs,
+// albums and credits are moved to it and they are deleted. The survivor takes the person or
+// group of the first duplicate defined as one when it is not defined itself.
+func (db *DataBase) MergePerformers(survivorID int64, duplicateIDs []int64) error {
+	return db.mergeRows("performer", `SELECT 1 FROM performers WHERE id_performer = ?`, survivorID, duplicateIDs,
+		`UPDATE rolas SET id_performer = ?1 WHERE id_performer = ?2`,
+		`UPDATE albums SET id_performer = ?1 WHERE id_performer = ?2`,
+		`INSERT OR IGNORE INTO credits (id_rola, id_performer, role)
+			SELECT id_rola, ?1, role FROM credits WHERE id_performer = ?2`,
+		`DELETE FROM credits WHERE id_performer = ?2`,
+		`UPDATE performers SET (id_type, id_person, id_group) =
+			(SELECT id_type, id_person, id_group FROM performers WHERE id_performer = ?2)
+			WHERE id_performer = ?1 AND id_person IS NULL AND id_group IS NULL AND EXISTS (SELECT 1 FROM performers
+				WHERE id_performer = ?2 AND (id_person IS NOT NULL OR id_group IS NOT NULL))`,
+		`DELETE FROM performers WHERE id_performer = ?2`,
+	)
+}
+
+// MergeAlbums merges the duplicate albums into the surviving one: their songs are moved to
+// it and they are deleted. The survivor takes the year, album artist and cover of the
+// duplicates it lacks.
+func (db *DataBase) MergeAlbums(survivorID int64, duplicateIDs []int64) error {
+	return db.mergeRows("album", `SELECT 1 FROM albums WHERE id_album = ?`, survivorID, duplicateIDs,
+		`UPDATE albums SET
+			year = IFNULL(NULLIF(year, 0), (SELECT year FROM albums WHERE id_album = ?2)),
+			id_performer = IFNULL(id_performer, (SELECT id_performer FROM albums WHERE id_album = ?2)),
+			cover = IFNULL(cover, (SELECT cover FROM albums WHERE id_album = ?2))
+			WHERE id_album = ?1`,
+		`UPDATE rolas SET id_album = ?1 WHERE id_album = ?2`,
+		`DELETE FROM albums WHERE id_album = ?2`,
+	)
+}
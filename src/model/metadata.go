@@ -0,0 +1,26 @@
+package model
+
+// TrackMetadata holds the tags mined from an audio file. Missing tags are left empty and
+// stored as NULL by the miner. Picture is the embedded cover picture, and Cover its hash
+// once it is stored in the cover cache. Audio describes the audio stream of MP3 files, and
+// Warnings the problems found in the file that did not stop it from being mined.
+type TrackMetadata struct {
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Genre       string
+	Year        int
+	Disc        int
+	DiscTotal   int
+	Track       int
+	TrackTotal  int
+	Composer    string
+	Comment     string
+	TagFormat   string
+	Format      string
+	Picture     []byte
+	Cover       string
+	Audio       AudioProperties
+	Warnings    []string
+}
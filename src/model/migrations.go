@@ -0,0 +1,301 @@
+package model
+
+import (
+	"fmt"
+	"database/sql"
+)
+
+// migration applies one change of the database schema inside a transaction.
+type migration func(tx *sql.Tx) error
+
+// migrations holds the ordered schema changes. The schema version of a database is the
+// number of migrations already applied to it, recorded in 'PRAGMA user_version'.
+// New migrations must always be appended, never inserted or modified.
+var migrations = []migration{
+	createBaseSchema,
+	addFileState,
+	addFileHash,
+	addFormat,
+	addCredits,
+	regroupAlbumsByArtistAndDirectory,
+	clearPlaceholders,
+	addCovers,
+	addAudioProperties,
+	addScanReports,
+	linkPerformerDetails,
+	addMembershipDetails,
+	splitArtistCredits,
+}
+
+// SchemaVersion returns the schema version understood by this binary.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// GetSchemaVersion returns the schema version recorded in the database.
+func (db *DataBase) GetSchemaVersion() (int, error) {
+	return getSchemaVersion(db.Db)
+}
+
+// getSchemaVersion reads the schema version stored in the database header.
+func getSchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+// migrate applies every pending migration in order, each one in its own transaction.
+// It refuses to touch a database whose version is newer than the binary understands.
+func migrate(db *sql.DB) error {
+	version, err := getSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than the supported version %d", version, SchemaVersion())
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := applyMigration(db, i+1, migrations[i]); err != nil {
+			return fmt.Errorf("migration to version %d failed: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs a single migration and records the new version in the same transaction.
+func applyMigration(db *sql.DB, version int, apply migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := apply(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// execAll executes the given queries in order inside the transaction.
+func execAll(tx *sql.Tx, queries ...string) error {
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createBaseSchema creates the original tables. It uses 'IF NOT EXISTS' so databases created
+// before versioning existed are adopted as version 1 without losing data.
+func createBaseSchema(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE IF NOT EXISTS types (
+			id_type INTEGER PRIMARY KEY,
+			description TEXT
+		);`,
+		`INSERT OR IGNORE INTO types (id_type, description) VALUES (0, 'Person');`,
+		`INSERT OR IGNORE INTO types (id_type, description) VALUES (1, 'Group');`,
+		`INSERT OR IGNORE INTO types (id_type, description) VALUES (2, 'Unknown');`,
+		`CREATE TABLE IF NOT EXISTS performers (
+			id_performer INTEGER PRIMARY KEY,
+			id_type INTEGER,
+			name TEXT,
+			FOREIGN KEY (id_type) REFERENCES types(id_type)
+		);`,
+		`CREATE TABLE IF NOT EXISTS persons (
+			id_person INTEGER PRIMARY KEY,
+			stage_name TEXT,
+			real_name TEXT,
+			birth_date TEXT,
+			death_date TEXT
+		);`,
+		`CREATE TABLE IF NOT EXISTS groups (
+			id_group INTEGER PRIMARY KEY,
+			name TEXT,
+			start_date TEXT,
+			end_date TEXT
+		);`,
+		`CREATE TABLE IF NOT EXISTS in_group (
+			id_person INTEGER,
+			id_group INTEGER,
+			PRIMARY KEY (id_person, id_group),
+			FOREIGN KEY (id_person) REFERENCES persons(id_person),
+			FOREIGN KEY (id_group) REFERENCES groups(id_group)
+		);`,
+		`CREATE TABLE IF NOT EXISTS albums (
+			id_album INTEGER PRIMARY KEY,
+			path TEXT,
+			name TEXT,
+			year INTEGER
+		);`,
+		`CREATE TABLE IF NOT EXISTS rolas (
+			id_rola INTEGER PRIMARY KEY,
+			id_performer INTEGER,
+			id_album INTEGER,
+			path TEXT,
+			title TEXT,
+			track INTEGER,
+			year INTEGER,
+			genre TEXT,
+			FOREIGN KEY (id_performer) REFERENCES performers(id_performer),
+			FOREIGN KEY (id_album) REFERENCES albums(id_album)
+		);`,
+	)
+}
+
+// addFileState records the size and modification time of each song's file, so rescans can
+// skip the files that did not change.
+func addFileState(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE rolas ADD COLUMN size INTEGER;`,
+		`ALTER TABLE rolas ADD COLUMN mtime INTEGER;`,
+		`CREATE INDEX IF NOT EXISTS rolas_path ON rolas (path);`,
+	)
+}
+
+// addFileHash records the content hash of each song's file, used to recognize moved files,
+// and flags the songs whose file disappeared.
+func addFileHash(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE rolas ADD COLUMN hash TEXT;`,
+		`ALTER TABLE rolas ADD COLUMN missing INTEGER NOT NULL DEFAULT 0;`,
+		`CREATE INDEX IF NOT EXISTS rolas_hash ON rolas (hash);`,
+	)
+}
+
+// addFormat records the audio format of each song's file. Only MP3 files were mined before,
+// so existing songs are marked as such.
+func addFormat(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE rolas ADD COLUMN format TEXT;`,
+		`UPDATE rolas SET format = 'mp3';`,
+	)
+}
+
+// addCredits records the album artist of each album, the disc number and comment of each
+// song, and a 'credits' table linking songs to the performers that took part in them in
+// roles other than the main one, such as their composers. Credits are deleted along with
+// their song.
+func addCredits(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE albums ADD COLUMN id_performer INTEGER REFERENCES performers(id_performer);`,
+		`ALTER TABLE rolas ADD COLUMN disc INTEGER NOT NULL DEFAULT 1;`,
+		`ALTER TABLE rolas ADD COLUMN comment TEXT;`,
+		`CREATE TABLE IF NOT EXISTS credits (
+			id_rola INTEGER,
+			id_performer INTEGER,
+			role TEXT NOT NULL,
+			PRIMARY KEY (id_rola, id_performer, role),
+			FOREIGN KEY (id_rola) REFERENCES rolas(id_rola),
+			FOREIGN KEY (id_performer) REFERENCES performers(id_performer)
+		);`,
+		`CREATE INDEX IF NOT EXISTS credits_performer ON credits (id_performer);`,
+		`CREATE TRIGGER IF NOT EXISTS rolas_credits_delete AFTER DELETE ON rolas BEGIN
+			DELETE FROM credits WHERE id_rola = old.id_rola;
+		END;`,
+	)
+}
+
+// regroupAlbumsByArtistAndDirectory splits the albums that were identified only by their
+// name and year, following the default album identity.
+func regroupAlbumsByArtistAndDirectory(tx *sql.Tx) error {
+	_, err := regroupAlbums(tx, AlbumByArtistAndDirectory)
+	return err
+}
+
+// clearPlaceholders replaces the 'Unknown' texts that used to be stored for missing tags with
+// NULL, unlinking the songs from the placeholder performer and album. The year and track that
+// were made up for those songs cannot be told apart from real ones, so their files are mined
+// again on the next rescan.
+func clearPlaceholders(tx *sql.Tx) error {
+	const unknownPerformers = `SELECT id_performer FROM performers WHERE name = 'Unknown' AND id_type = 2`
+	const unknownAlbums = `SELECT id_album FROM albums WHERE name = 'Unknown'`
+	return execAll(tx,
+		`UPDATE rolas SET size = NULL WHERE title = 'Unknown' OR genre = 'Unknown'
+			OR id_performer IN (`+unknownPerformers+`) OR id_album IN (`+unknownAlbums+`);`,
+		`UPDATE rolas SET title = NULL WHERE title = 'Unknown';`,
+		`UPDATE rolas SET genre = NULL WHERE genre = 'Unknown';`,
+		`UPDATE rolas SET id_performer = NULL WHERE id_performer IN (`+unknownPerformers+`);`,
+		`UPDATE rolas SET id_album = NULL WHERE id_album IN (`+unknownAlbums+`);`,
+		`DELETE FROM performers WHERE name = 'Unknown' AND id_type = 2
+			AND id_performer NOT IN (SELECT id_performer FROM albums WHERE id_performer IS NOT NULL)
+			AND id_performer NOT IN (SELECT id_performer FROM credits);`,
+		`DELETE FROM albums WHERE name = 'Unknown';`,
+	)
+}
+
+// addCovers records the hash of the cached cover picture embedded in each song and of the
+// cover of each album. The files mined before are mined again on the next rescan to read
+// their pictures.
+func addCovers(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE rolas ADD COLUMN cover TEXT;`,
+		`ALTER TABLE albums ADD COLUMN cover TEXT;`,
+		`UPDATE rolas SET size = NULL;`,
+	)
+}
+
+// addAudioProperties records the duration in milliseconds, bitrate, sample rate, channel mode
+// and encoder of each song, and whether its bitrate is variable. The MP3 files mined before
+// are mined again on the next rescan to read them.
+func addAudioProperties(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE rolas ADD COLUMN duration_ms INTEGER;`,
+		`ALTER TABLE rolas ADD COLUMN bitrate INTEGER;`,
+		`ALTER TABLE rolas ADD COLUMN sample_rate INTEGER;`,
+		`ALTER TABLE rolas ADD COLUMN channels TEXT;`,
+		`ALTER TABLE rolas ADD COLUMN vbr INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE rolas ADD COLUMN encoder TEXT;`,
+		`UPDATE rolas SET size = NULL WHERE format = 'mp3';`,
+	)
+}
+
+// addScanReports keeps the report of the last scan, as JSON, in a table of a single row.
+func addScanReports(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE IF NOT EXISTS scan_reports (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			report TEXT NOT NULL
+		);`,
+	)
+}
+
+// linkPerformerDetails links each performer defined as a person or a group to the row holding
+// its details. The performers defined before are linked to the last person with their name as
+// stage name, or to the last group with their name.
+func linkPerformerDetails(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE performers ADD COLUMN id_person INTEGER REFERENCES persons(id_person);`,
+		`ALTER TABLE performers ADD COLUMN id_group INTEGER REFERENCES groups(id_group);`,
+		`UPDATE performers SET id_person = (SELECT MAX(id_person) FROM persons WHERE stage_name = performers.name)
+			WHERE id_type = 0;`,
+		`UPDATE performers SET id_group = (SELECT MAX(id_group) FROM groups WHERE name = performers.name)
+			WHERE id_type = 1;`,
+	)
+}
+
+// addMembershipDetails records when each person joined and left a group, and their role or
+// instrument in it.
+func addMembershipDetails(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE in_group ADD COLUMN start_date TEXT;`,
+		`ALTER TABLE in_group ADD COLUMN end_date TEXT;`,
+		`ALTER TABLE in_group ADD COLUMN role TEXT;`,
+	)
+}
+
+// splitArtistCredits credits the artists of each song, which used to be a single performer
+// named after the whole artist tag. Until the files of the songs with an artist are mined
+// again on the next rescan to split their tags, that performer is their only artist.
+func splitArtistCredits(tx *sql.Tx) error {
+	return execAll(tx,
+		`INSERT OR IGNORE INTO credits (id_rola, id_performer, role)
+			SELECT id_rola, id_performer, 'artist' FROM rolas WHERE id_performer IS NOT NULL;`,
+		`UPDATE rolas SET size = NULL WHERE id_performer IS NOT NULL;`,
+	)
+}
@@ -1,30 +1,52 @@
 package model
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"time"
+	"slices"
+	"strings"
 	"github.com/dhowden/tag"
 )
 
-// Miner is responsible for mining metadata from MP3 files.
-type Miner struct{}
+// Miner is responsible for mining metadata from audio files. AlbumIdentity decides which
+// songs it stores in the same album, and Patterns infer tags from the files' paths according
+// to PatternMode. Embedded cover pictures are stored in Covers, unless it is nil, and Artists
+// splits the artist tags into the performers credited on each song.
+type Miner struct{
+	formats []AudioFormat
+	AlbumIdentity AlbumIdentity
+	Patterns []*FilenamePattern
+	PatternMode PatternMode
+	Covers *CoverCache
+	Artists ArtistSplitter
+}
 
-// NewMiner creates and returns a new Miner instance.
+// NewMiner creates and returns a new Miner instance that reads the default formats,
+// identifies albums by album artist and directory and splits artists on the default
+// separators.
 func NewMiner() *Miner {
-	return &Miner{}
+	return &Miner{formats: DefaultFormats(), AlbumIdentity: AlbumByArtistAndDirectory, Artists: DefaultArtistSplitter()}
 }
 
-// FindMP3Files traverses the specified directory and returns a list of MP3 files.
+// FindMP3Files traverses the specified directory and returns a list of audio files.
+//
+// Deprecated: Use FindAudioFiles, which this calls.
 func (miner *Miner) FindMP3Files(directory string) ([]string, error) {
-	const mp3 = ".mp3"
+	return miner.FindAudioFiles(directory)
+}
+
+// FindAudioFiles traverses the specified directory and returns a list of the files with the
+// extension of a registered format.
+func (miner *Miner) FindAudioFiles(directory string) ([]string, error) {
 	var files []string
 
 	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() && filepath.Ext(path) == mp3 {
+		if !info.IsDir() && miner.IsAudioFile(path) {
 			files = append(files, path)
 		}
 		return nil
@@ -36,103 +58,302 @@ func (miner *Miner) FindMP3Files(directory string) ([]string, error) {
 	return files, nil
 }
 
-// MineMetadata extracts metadata from a given MP3 file.
-func (miner *Miner) MineMetadata(file string) (map[string]interface{}, error) {
+// MineMetadata extracts metadata from a given audio file, along with its format, inferring
+// tags from its path with the miner's patterns. Its embedded picture is stored in the miner's
+// cover cache; a picture that cannot be decoded is ignored with a warning.
+func (miner *Miner) MineMetadata(file string) (TrackMetadata, error) {
+	metadata, err := miner.ReadTags(file)
+	if err != nil {
+		return TrackMetadata{}, err
+	}
+	metadata, _ = miner.InferTags(file, metadata)
+	if miner.Covers != nil && len(metadata.Picture) > 0 {
+		if metadata.Cover, err = miner.Covers.Store(metadata.Picture); err != nil {
+			metadata.Warnings = append(metadata.Warnings, fmt.Sprintf("ignoring the cover: %v", err))
+		}
+	}
+	return metadata, nil
+}
+
+// ReadTags extracts the tags stored in a given audio file, along with its format and, for MP3
+// files, the properties of its audio. A file without tags has empty metadata, and an MP3 file
+// whose audio cannot be read has empty properties. The values of an ID3v2.4 artist with several of
+// them are kept separated by null characters.
+func (miner *Miner) ReadTags(file string) (TrackMetadata, error) {
 	f, err := os.Open(file)
 	if err != nil {
-		return nil, err
+		return TrackMetadata{}, err
 	}
 	defer f.Close()
 
+	format, err := miner.DetectFormat(file, f)
+	if err != nil {
+		return TrackMetadata{}, err
+	}
+	tags := TrackMetadata{Disc: 1}
 	metadata, err := tag.ReadFrom(f)
+	if err == nil {
+		tags = miner.AssignTag(metadata)
+	} else if err != tag.ErrNoTagsFound {
+		return TrackMetadata{}, err
+	}
+	tags.Format = format
+	if format == "mp3" && tags.TagFormat == string(tag.ID3v2_4) {
+		tags.Artist = readID3Artist(f, tags.Artist)
+	}
+	if format == "mp3" {
+		if audio, err := ReadMPEGProperties(f); err == nil {
+			tags.Audio = audio
+		}
+	}
+	return tags, nil
+}
+
+// readID3Artist reads the artist of the ID3v2.4 tag of an MP3 file again, since the tag reader
+// joins its values without a separator. It returns the values separated by null characters,
+// or artist when the frame has a single value or cannot be read again.
+func readID3Artist(f io.ReadSeeker, artist string) string {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return artist
+	}
+	frames, _, _, err := readID3Frames(f)
 	if err != nil {
-		return nil, err
+		return artist
+	}
+	for _, frame := range frames {
+		if frame.id == "TPE1" {
+			if values := decodeID3Text(frame.data); strings.Contains(values, "\x00") {
+				return strings.TrimSpace(values)
+			}
+		}
 	}
-	return miner.AssignTag(metadata), nil
+	return artist
 }
 
-// AssignTag replaces empty extracted metadata by assigning default values such as 'Unknown',
-// '1' and the current year.
-func (miner *Miner) AssignTag(metadata tag.Metadata) map[string]interface{} {
+// AssignTag copies the extracted metadata, trimming the text tags, along with the embedded
+// picture. Tags the file does not have are left empty, or zero for numbers, so they are stored
+// as missing; only a missing disc number is taken as the first disc.
+func (miner *Miner) AssignTag(metadata tag.Metadata) TrackMetadata {
 	disc, totalDiscs := metadata.Disc()
 	trackNumber, totalTracks := metadata.Track()
-	disc, totalDiscs = checkTrackTag(disc, totalDiscs)
-	trackNumber, totalTracks = checkTrackTag(trackNumber, totalTracks)
-	return map[string]interface{} {
-		"Title":        checkStringTag(metadata.Title()),
-		"Artist":       checkStringTag(metadata.Artist()),
-		"Album":        checkStringTag(metadata.Album()),
-		"AlbumArtist":  checkStringTag(metadata.AlbumArtist()),
-		"Genre":        checkStringTag(metadata.Genre()),
-		"Year":         checkYearTag(metadata.Year()),
-		"Disc":         map[string]int{"Number": disc, "Total": totalDiscs},
-		"Comment":      checkStringTag(metadata.Comment()),
-		"Track":        map[string]int{"Number": trackNumber, "Total": totalTracks},
-		"Composer":     checkStringTag(metadata.Composer()),
+	var picture []byte
+	if metadata.Picture() != nil {
+		picture = metadata.Picture().Data
 	}
-}
-
-// checkStringTag returns "Unknown" if the tag is empty.
-func checkStringTag(tag string) string {
-	if tag == "" {
-		return "Unknown"
+	return TrackMetadata{
+		Title:       strings.TrimSpace(metadata.Title()),
+		Artist:      strings.TrimSpace(metadata.Artist()),
+		AlbumArtist: strings.TrimSpace(metadata.AlbumArtist()),
+		Album:       strings.TrimSpace(metadata.Album()),
+		Genre:       strings.TrimSpace(metadata.Genre()),
+		Year:        metadata.Year(),
+		Disc:        max(disc, 1),
+		DiscTotal:   totalDiscs,
+		Track:       trackNumber,
+		TrackTotal:  totalTracks,
+		Composer:    strings.TrimSpace(metadata.Composer()),
+		Comment:     strings.TrimSpace(metadata.Comment()),
+		TagFormat:   string(metadata.Format()),
+		Picture:     picture,
 	}
-	return tag
 }
 
-// checkYearTag returns the current year if the year is 0.
-func checkYearTag(year int) int {
-	if year == 0 {
-		return time.Now().Year()
+// ProcessFile mines metadata from an audio file and inserts it into the database. Files whose
+// size and modification time did not change since they were mined are skipped, and modified
+// files update their existing song.
+func (miner *Miner) ProcessFile(db *DataBase, file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
 	}
-	return year
-}
-
-// checkTrackTag returns default values if any track tag is 0.
-func checkTrackTag(trackNumber int, totalTracks int) (int, int) {
-	if trackNumber == 0 && totalTracks == 0{
-		return 1, 1
-	} else if trackNumber == 0 {
-		return 1, totalTracks
-	} else if totalTracks == 0 {
-		return trackNumber, 1
+	state, known, err := db.GetFileState(file)
+	if err != nil {
+		return err
+	}
+	if known && state.Matches(info) {
+		if state.Missing {
+			return db.SetMissing(state.SongID, false)
+		}
+		return nil
 	}
-	return trackNumber, totalTracks
-}
 
-// ProcessFile mines metadata from an MP3 file and inserts it into the database.
-func (miner *Miner) ProcessFile(db *DataBase, file string) error {
+	hash, err := HashFile(file)
+	if err != nil {
+		return err
+	}
 	metadata, err := miner.MineMetadata(file)
 	if err != nil {
 		return err
 	}
+	_, _, err = miner.StoreMetadata(db, file, info, hash, metadata)
+	return err
+}
 
-	var performerID int64
-	if metadata["Artist"] == "Unknown" {
-		performerID, err = db.InsertPerformerIfNotExists(metadata["Artist"].(string), 2)
-	} else {
-		performerID, err = db.InsertPerformerIfNotExists(metadata["Artist"].(string), 0)
+// StoreMetadata stores the metadata mined from a file, described by info and its content hash,
+// in the database. If the file was already mined its song is updated instead of inserting a
+// new one, and if it has the content of a song whose file is missing, the file was moved: the
+// song follows it and keeps its data, including any edits. The artist tag is split by the
+// miner's splitter into the performers credited as artists of the song, the first one being
+// its performer, and those featured in it; an artist tag naming a performer defined as a
+// person or group is kept whole. The album artist and composer are stored as performers,
+// credited to the album when it has no artist yet and to the song in the composer role, and
+// the album is found with the miner's album identity. Missing tags are stored as NULL. It
+// returns whether the song was added, updated or moved, and the IDs of the albums the song
+// left or joined, whose covers may have changed. Every write runs in one transaction, or in a
+// savepoint of the batch db belongs to, so a file is never stored halfway.
+func (miner *Miner) StoreMetadata(db *DataBase, file string, info os.FileInfo, hash string, metadata TrackMetadata) (StoreResult, []int64, error) {
+	var result StoreResult
+	var albumIDs []int64
+	err := db.transaction(func(tx *DataBase) error {
+		var err error
+		result, albumIDs, err = miner.storeMetadata(tx, file, info, hash, metadata)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
 	}
+	return result, albumIDs, nil
+}
+
+// storeMetadata stores the metadata mined from a file as StoreMetadata does.
+func (miner *Miner) storeMetadata(db *DataBase, file string, info os.FileInfo, hash string, metadata TrackMetadata) (StoreResult, []int64, error) {
+	songID, err := db.GetSongIDByPath(file)
 	if err != nil {
-		return err
+		return 0, nil, err
+	}
+	if songID == 0 {
+		movedID, err := db.FindMissingSong(hash)
+		if err != nil {
+			return 0, nil, err
+		}
+		if movedID != 0 {
+			if err := db.MoveSong(movedID, file); err != nil {
+				return 0, nil, err
+			}
+			albumID, err := db.songAlbumID(movedID)
+			if err != nil {
+				return 0, nil, err
+			}
+			return SongMoved, touchedAlbums(albumID), db.SetFileState(movedID, info, hash)
+		}
+	}
+	var previousAlbumID int64
+	if songID != 0 {
+		if previousAlbumID, err = db.songAlbumID(songID); err != nil {
+			return 0, nil, err
+		}
 	}
 
-	albumPath := filepath.Dir(file)
-	albumID, err := db.InsertAlbumIfNotExists(metadata["Album"].(string), metadata["Year"].(int), albumPath)
+	var performerID, albumArtistID, albumID int64
+	artistIDs, featuredIDs, err := miner.storeArtists(db, metadata.Artist)
 	if err != nil {
-		return err
+		return 0, nil, err
+	}
+	if len(artistIDs) > 0 {
+		performerID = artistIDs[0]
+	}
+	if metadata.AlbumArtist != "" {
+		if albumArtistID, err = db.InsertPerformerIfNotExists(metadata.AlbumArtist, 0); err != nil {
+			return 0, nil, err
+		}
+	}
+	if metadata.Album != "" {
+		albumID, err = db.GetOrInsertAlbum(miner.AlbumIdentity, metadata.Album, metadata.Year, albumArtistID, file)
+		if err != nil {
+			return 0, nil, err
+		}
+		if albumArtistID != 0 {
+			if err := db.fillAlbumArtist(albumID, albumArtistID); err != nil {
+				return 0, nil, err
+			}
+		}
 	}
 
 	song := Song{
+		ID: songID,
 		PerformerID: performerID,
 		AlbumID: albumID,
 		Path: file,
-		Title: metadata["Title"].(string),
-		Track: metadata["Track"].(map[string]int)["Number"],
-		Year: metadata["Year"].(int),
-		Genre: metadata["Genre"].(string),
+		Title: metadata.Title,
+		Track: metadata.Track,
+		Year: metadata.Year,
+		Genre: metadata.Genre,
+		Format: metadata.Format,
+		Disc: metadata.Disc,
+		Comment: metadata.Comment,
+		Cover: metadata.Cover,
+		Duration: metadata.Audio.Duration,
+		Bitrate: metadata.Audio.Bitrate,
+		SampleRate: metadata.Audio.SampleRate,
+		Channels: metadata.Audio.Channels,
+		VBR: metadata.Audio.VBR,
+		Encoder: metadata.Audio.Encoder,
+	}
+	result := SongUpdated
+	if song.ID != 0 {
+		err = db.UpdateSongMetadata(&song)
+	} else if err = db.InsertSong(&song); err == nil {
+		result = SongAdded
+	}
+	if err != nil {
+		return 0, nil, err
 	}
-	_, err = db.InsertSongIfNotExists(song.PerformerID, song.AlbumID, song.Path, song.Title, song.Genre, song.Track, song.Year)
 
-	return err
-}
\ No newline at end of file
+	var composerIDs []int64
+	if metadata.Composer != "" {
+		composerID, err := db.InsertPerformerIfNotExists(metadata.Composer, 0)
+		if err != nil {
+			return 0, nil, err
+		}
+		composerIDs = append(composerIDs, composerID)
+	}
+	if err := db.SetCredits(song.ID, RoleComposer, composerIDs); err != nil {
+		return 0, nil, err
+	}
+	if err := db.SetCredits(song.ID, RoleArtist, artistIDs); err != nil {
+		return 0, nil, err
+	}
+	if err := db.SetCredits(song.ID, RoleFeatured, featuredIDs); err != nil {
+		return 0, nil, err
+	}
+	return result, touchedAlbums(previousAlbumID, albumID), db.SetFileState(song.ID, info, hash)
+}
+
+// touchedAlbums returns the IDs of the albums that are not 0, without repeating them.
+func touchedAlbums(albumIDs ...int64) []int64 {
+	var touched []int64
+	for _, id := range albumIDs {
+		if id != 0 && !slices.Contains(touched, id) {
+			touched = append(touched, id)
+		}
+	}
+	return touched
+}
+
+// storeArtists splits an artist tag with the miner's splitter and returns the IDs of its
+// primary and featured artists, inserting the performers that do not exist.
+func (miner *Miner) storeArtists(db *DataBase, artist string) ([]int64, []int64, error) {
+	if artist == "" {
+		return nil, nil, nil
+	}
+	definedID, err := db.GetDefinedPerformerID(artist)
+	if err != nil {
+		return nil, nil, err
+	}
+	if definedID != 0 {
+		return []int64{definedID}, nil, nil
+	}
+
+	primary, featured := miner.Artists.Split(artist)
+	var ids [2][]int64
+	for i, names := range [2][]string{primary, featured} {
+		for _, name := range names {
+			id, err := db.InsertPerformerIfNotExists(name, 0)
+			if err != nil {
+				return nil, nil, err
+			}
+			ids[i] = append(ids[i], id)
+		}
+	}
+	return ids[0], ids[1], nil
+}
@@ -0,0 +1,297 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// AudioProperties describe the audio stream of a file: its duration, its bitrate in kbps,
+// averaged for variable bitrate files, its sample rate in Hz, its channel mode and the
+// encoder that produced it when the file records it.
+type AudioProperties struct {
+	Duration   time.Duration
+	Bitrate    int
+	SampleRate int
+	Channels   string
+	VBR        bool
+	Encoder    string
+}
+
+// String describes the properties as in "3:25, 320 kbps VBR, 44100 Hz, joint stereo,
+// LAME3.100", leaving out the unknown ones.
+func (properties AudioProperties) String() string {
+	var parts []string
+	if properties.Duration > 0 {
+		seconds := int(properties.Duration.Round(time.Second) / time.Second)
+		if seconds >= 3600 {
+			parts = append(parts, fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d:%02d", seconds/60, seconds%60))
+		}
+	}
+	if properties.Bitrate > 0 {
+		bitrate := fmt.Sprintf("%d kbps", properties.Bitrate)
+		if properties.VBR {
+			bitrate += " VBR"
+		}
+		parts = append(parts, bitrate)
+	}
+	if properties.SampleRate > 0 {
+		parts = append(parts, fmt.Sprintf("%d Hz", properties.SampleRate))
+	}
+	for _, text := range []string{properties.Channels, properties.Encoder} {
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ErrNoMPEGFrames is returned when no MPEG audio frame is found at the start of a file.
+var ErrNoMPEGFrames = errors.New("no MPEG audio frames found")
+
+// mpegScanLimit is how many bytes after the ID3v2 tag are searched for the first frame.
+const mpegScanLimit = 64 * 1024
+
+// mpegBitrates are the bitrates in kbps by version (MPEG-1, or MPEG-2 and 2.5), layer and
+// bitrate index.
+var mpegBitrates = [2][3][15]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// mpegSampleRates are the sample rates in Hz of MPEG-1, MPEG-2 and MPEG-2.5 by index.
+var mpegSampleRates = [3][3]int{{44100, 48000, 32000}, {22050, 24000, 16000}, {11025, 12000, 8000}}
+
+// mpegChannelModes name the channel modes by index.
+var mpegChannelModes = [4]string{"stereo", "joint stereo", "dual channel", "mono"}
+
+// mpegFrame is a decoded MPEG audio frame header.
+type mpegFrame struct {
+	version    int
+	layer      int
+	bitrate    int
+	sampleRate int
+	channels   int
+	length     int
+}
+
+// parseMPEGFrame decodes the 4 byte header of an MPEG audio frame. Free format frames, whose
+// length cannot be told from the header, are refused.
+func parseMPEGFrame(header []byte) (mpegFrame, bool) {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return mpegFrame{}, false
+	}
+	versionBits, layerBits := header[1]>>3&3, header[1]>>1&3
+	bitrateIndex, sampleIndex := int(header[2]>>4), int(header[2]>>2&3)
+	if versionBits == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleIndex == 3 {
+		return mpegFrame{}, false
+	}
+
+	frame := mpegFrame{layer: 4 - int(layerBits), channels: int(header[3] >> 6)}
+	switch versionBits {
+	case 3:
+		frame.version = 1
+	case 2:
+		frame.version = 2
+	default:
+		frame.version = 3
+	}
+	frame.bitrate = mpegBitrates[min(frame.version, 2)-1][frame.layer-1][bitrateIndex]
+	frame.sampleRate = mpegSampleRates[frame.version-1][sampleIndex]
+	padding := int(header[2] >> 1 & 1)
+	switch {
+	case frame.layer == 1:
+		frame.length = (12*frame.bitrate*1000/frame.sampleRate + padding) * 4
+	case frame.layer == 3 && frame.version != 1:
+		frame.length = 72*frame.bitrate*1000/frame.sampleRate + padding
+	default:
+		frame.length = 144*frame.bitrate*1000/frame.sampleRate + padding
+	}
+	return frame, true
+}
+
+// samples returns the number of samples per channel in the frame.
+func (frame mpegFrame) samples() int {
+	switch {
+	case frame.layer == 1:
+		return 384
+	case frame.layer == 3 && frame.version != 1:
+		return 576
+	}
+	return 1152
+}
+
+// sideInfoLength returns the length of the side information that follows the header of a
+// Layer III frame, where a Xing header is stored after it.
+func (frame mpegFrame) sideInfoLength() int {
+	mono := frame.channels == 3
+	switch {
+	case frame.version == 1 && mono:
+		return 17
+	case frame.version == 1:
+		return 32
+	case mono:
+		return 9
+	}
+	return 17
+}
+
+// ReadMPEGProperties reads the audio properties of an MP3 stream from its frames. The first
+// frame is found after the ID3v2 tag, skipped by the size in its header without reading its
+// frames; when it holds a Xing, Info or VBRI header, the number of frames it records gives the
+// exact duration and the average bitrate, and a LAME header gives the encoder. Otherwise the
+// stream is taken as constant bitrate and its duration is computed from its size, leaving out
+// an ID3v1 tag at the end.
+func ReadMPEGProperties(r io.ReadSeeker) (AudioProperties, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return AudioProperties{}, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return AudioProperties{}, err
+	}
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return AudioProperties{}, err
+	}
+	audioStart := id3AudioStart(header)
+	if _, err := r.Seek(audioStart, io.SeekStart); err != nil {
+		return AudioProperties{}, err
+	}
+	data := make([]byte, mpegScanLimit)
+	n, err := io.ReadFull(r, data)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return AudioProperties{}, err
+	}
+	data = data[:n]
+
+	offset, frame, ok := findMPEGFrame(data)
+	if !ok {
+		return AudioProperties{}, ErrNoMPEGFrames
+	}
+	properties := AudioProperties{
+		Bitrate: frame.bitrate,
+		SampleRate: frame.sampleRate,
+		Channels: mpegChannelModes[frame.channels],
+	}
+
+	audioSize := size - audioStart - int64(offset)
+	if size >= 128 {
+		trailer := make([]byte, 3)
+		if _, err := r.Seek(size-128, io.SeekStart); err == nil {
+			if _, err := io.ReadFull(r, trailer); err == nil && string(trailer) == "TAG" {
+				audioSize -= 128
+			}
+		}
+	}
+
+	frames, streamBytes, encoder, vbr := readVBRHeader(data[offset:], frame)
+	properties.Encoder = encoder
+	if frames > 0 {
+		seconds := float64(frames) * float64(frame.samples()) / float64(frame.sampleRate)
+		properties.Duration = time.Duration(seconds * float64(time.Second))
+		properties.VBR = vbr
+		if streamBytes == 0 {
+			streamBytes = audioSize - int64(frame.length)
+		}
+		if vbr && seconds > 0 {
+			properties.Bitrate = int(float64(streamBytes) * 8 / seconds / 1000 + 0.5)
+		}
+		return properties, nil
+	}
+	properties.Duration = time.Duration(float64(audioSize) * 8 / float64(frame.bitrate*1000) * float64(time.Second))
+	return properties, nil
+}
+
+// findMPEGFrame finds the first frame in the data whose next frame, when the data holds it,
+// is also valid, so a stray sync pattern is not taken for a frame.
+func findMPEGFrame(data []byte) (int, mpegFrame, bool) {
+	for offset := 0; offset+4 <= len(data); offset++ {
+		frame, ok := parseMPEGFrame(data[offset:])
+		if !ok {
+			continue
+		}
+		next := offset + frame.length
+		if next+4 <= len(data) {
+			if nextFrame, ok := parseMPEGFrame(data[next:]); !ok || nextFrame.version != frame.version || nextFrame.layer != frame.layer {
+				continue
+			}
+		}
+		return offset, frame, true
+	}
+	return 0, mpegFrame{}, false
+}
+
+// readVBRHeader reads the Xing, Info or VBRI header stored in the first frame. It returns the
+// number of frames and bytes of the stream, zero when they are not recorded, the encoder named
+// by a LAME header, and whether the stream has a variable bitrate. An Info header is written
+// by encoders for constant bitrate streams.
+func readVBRHeader(data []byte, frame mpegFrame) (int64, int64, string, bool) {
+	if frame.layer != 3 {
+		return 0, 0, "", false
+	}
+	xing := 4 + frame.sideInfoLength()
+	if len(data) >= xing+8 {
+		id := string(data[xing : xing+4])
+		if id == "Xing" || id == "Info" {
+			flags := binary.BigEndian.Uint32(data[xing+4:])
+			position := xing + 8
+			var frames, size int64
+			for _, field := range []struct{ flag uint32; length int; value *int64 }{
+				{1, 4, &frames}, {2, 4, &size}, {4, 100, nil}, {8, 4, nil},
+			} {
+				if flags&field.flag == 0 {
+					continue
+				}
+				if len(data) < position+field.length {
+					return frames, size, "", id == "Xing"
+				}
+				if field.value != nil {
+					*field.value = int64(binary.BigEndian.Uint32(data[position:]))
+				}
+				position += field.length
+			}
+			encoder := ""
+			if len(data) >= position+9 {
+				encoder = encoderName(data[position : position+9])
+			}
+			return frames, size, encoder, id == "Xing"
+		}
+	}
+	vbri := 4 + 32
+	if len(data) >= vbri+18 && string(data[vbri:vbri+4]) == "VBRI" {
+		size := int64(binary.BigEndian.Uint32(data[vbri+10:]))
+		frames := int64(binary.BigEndian.Uint32(data[vbri+14:]))
+		return frames, size, "", true
+	}
+	return 0, 0, "", false
+}
+
+// encoderName returns the encoder version stored in a LAME header, such as "LAME3.100", or
+// an empty text when the bytes do not hold one.
+func encoderName(data []byte) string {
+	name := strings.TrimRight(string(bytes.TrimRight(data, "\x00")), " ")
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return ""
+	}
+	for _, c := range []byte(name) {
+		if c < 0x20 || c > 0x7E {
+			return ""
+		}
+	}
+	return name
+}
@@ -0,0 +1,156 @@
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PatternMode decides whether the tags inferred from a file's path replace the tags read
+// from the file.
+type PatternMode string
+
+const (
+	// PatternFallback only fills the tags the file does not have. It is the default mode.
+	PatternFallback PatternMode = "fallback"
+	// PatternOverride replaces the tags of the file with the inferred ones.
+	PatternOverride PatternMode = "override"
+)
+
+// patternFields are the placeholders a filename pattern can use, and whether they hold
+// numbers.
+var patternFields = map[string]bool{
+	"artist": false, "albumartist": false, "album": false, "title": false, "genre": false,
+	"composer": false, "year": true, "track": true, "disc": true,
+}
+
+// placeholder matches a placeholder of a filename pattern, such as %artist%.
+var placeholder = regexp.MustCompile(`%([a-z]+)%`)
+
+// patternExtension matches an extension at the end of a pattern.
+var patternExtension = regexp.MustCompile(`\.[A-Za-z0-9]+$`)
+
+// FilenamePattern infers tags from the path of a file, such as
+// '%artist%/%album% (%year%)/%track% - %title%.mp3'. Each '/' separated part of the pattern
+// matches a directory of the path, counting from the file. The extension is ignored, so a
+// pattern applies to every audio format.
+type FilenamePattern struct {
+	Pattern string
+	regexp  *regexp.Regexp
+	fields  []string
+}
+
+// CompilePattern parses a filename pattern.
+func CompilePattern(pattern string) (*FilenamePattern, error) {
+	compiled := &FilenamePattern{Pattern: pattern}
+	text := patternExtension.ReplaceAllString(filepath.ToSlash(pattern), "")
+	expression := `(?:^|/)`
+	last := 0
+	for _, match := range placeholder.FindAllStringSubmatchIndex(text, -1) {
+		name := text[match[2]:match[3]]
+		numeric, ok := patternFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown placeholder '%%%s%%' in pattern '%s'", name, pattern)
+		}
+		expression += regexp.QuoteMeta(text[last:match[0]])
+		if numeric {
+			expression += `(\d+)`
+		} else {
+			expression += `([^/]+?)`
+		}
+		compiled.fields = append(compiled.fields, name)
+		last = match[1]
+	}
+	if len(compiled.fields) == 0 {
+		return nil, fmt.Errorf("pattern '%s' has no placeholders", pattern)
+	}
+	expression += regexp.QuoteMeta(text[last:]) + `$`
+
+	var err error
+	if compiled.regexp, err = regexp.Compile(expression); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// Match returns the values of the placeholders found in the file's path, keyed by placeholder
+// name, and false if the path does not follow the pattern.
+func (pattern *FilenamePattern) Match(file string) (map[string]string, bool) {
+	path := filepath.ToSlash(strings.TrimSuffix(file, filepath.Ext(file)))
+	match := pattern.regexp.FindStringSubmatch(path)
+	if match == nil {
+		return nil, false
+	}
+	values := make(map[string]string)
+	for i, name := range pattern.fields {
+		value := strings.TrimSpace(match[i+1])
+		if previous, ok := values[name]; ok && previous != value {
+			return nil, false
+		}
+		values[name] = value
+	}
+	return values, true
+}
+
+// InferTags fills the tags of a file with the values found in its path by the first of the
+// miner's patterns it follows. In fallback mode only the missing tags are filled. It returns
+// the metadata and the names of the tags that were inferred.
+func (miner *Miner) InferTags(file string, metadata TrackMetadata) (TrackMetadata, []string) {
+	for _, pattern := range miner.Patterns {
+		values, ok := pattern.Match(file)
+		if !ok {
+			continue
+		}
+		var inferred []string
+		for _, name := range pattern.fields {
+			if metadata.setInferred(name, values[name], miner.PatternMode == PatternOverride) {
+				inferred = append(inferred, name)
+			}
+		}
+		return metadata, inferred
+	}
+	return metadata, nil
+}
+
+// setInferred sets the tag named by a pattern placeholder to an inferred value, unless the
+// tag already has a value and override is false. It reports whether the tag changed.
+func (metadata *TrackMetadata) setInferred(name, value string, override bool) bool {
+	setText := func(tag *string) bool {
+		if value == "" || *tag == value || (*tag != "" && !override) {
+			return false
+		}
+		*tag = value
+		return true
+	}
+	setNumber := func(tag *int, missing int) bool {
+		number, err := strconv.Atoi(value)
+		if err != nil || number == 0 || *tag == number || (*tag != missing && !override) {
+			return false
+		}
+		*tag = number
+		return true
+	}
+	switch name {
+	case "artist":
+		return setText(&metadata.Artist)
+	case "albumartist":
+		return setText(&metadata.AlbumArtist)
+	case "album":
+		return setText(&metadata.Album)
+	case "title":
+		return setText(&metadata.Title)
+	case "genre":
+		return setText(&metadata.Genre)
+	case "composer":
+		return setText(&metadata.Composer)
+	case "year":
+		return setNumber(&metadata.Year, 0)
+	case "track":
+		return setNumber(&metadata.Track, 0)
+	case "disc":
+		return setNumber(&metadata.Disc, 1)
+	}
+	return false
+}
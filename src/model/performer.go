@@ -5,4 +5,13 @@ type Performer struct {
 	ID int64
 	Type int
 	Name string
-}
\ No newline at end of file
+}
+
+// PerformerDetails hold a performer along with the person or group it is defined as, and the
+// groups that person is a member of.
+type PerformerDetails struct {
+	Performer
+	Person *Person
+	Group *Group
+	Groups []Group
+}
@@ -0,0 +1,10 @@
+package model
+
+// Person represents a performer who is a single artist.
+type Person struct {
+	ID int64
+	StageName string
+	RealName string
+	BirthDate string
+	DeathDate string
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// StoreResult tells what storing the metadata of a file did to its song.
+type StoreResult int
+
+const (
+	SongAdded StoreResult = iota + 1
+	SongUpdated
+	SongMoved
+)
+
+// ScanFailure is a file that could not be mined and the reason why.
+type ScanFailure struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// ScanReport summarizes a mining of the music directory: how many files were scanned, and of
+// them how many added, updated or moved a song, were skipped because they did not change, or
+// failed, with the reason of each failure. Warnings are the problems found in files that were
+// mined anyway. Missing counts the songs whose file disappeared, and Error holds the error
+// that stopped the mining, if any.
+type ScanReport struct {
+	Directory string        `json:"directory"`
+	Started   time.Time     `json:"started"`
+	Elapsed   time.Duration `json:"elapsed_ns"`
+	Cancelled bool          `json:"cancelled"`
+	Error     string        `json:"error,omitempty"`
+	Scanned   int           `json:"scanned"`
+	Added     int           `json:"added"`
+	Updated   int           `json:"updated"`
+	Moved     int           `json:"moved"`
+	Skipped   int           `json:"skipped"`
+	Missing   int           `json:"missing"`
+	Failed    int           `json:"failed"`
+	Failures  []ScanFailure `json:"failures"`
+	Warnings  []ScanFailure `json:"warnings,omitempty"`
+}
+
+// Count records what storing a file did.
+func (report *ScanReport) Count(result StoreResult) {
+	switch result {
+	case SongAdded:
+		report.Added++
+	case SongUpdated:
+		report.Updated++
+	case SongMoved:
+		report.Moved++
+	}
+}
+
+// Fail records a file that could not be mined.
+func (report *ScanReport) Fail(file string, err error) {
+	report.Failed++
+	report.Failures = append(report.Failures, ScanFailure{File: file, Reason: err.Error()})
+}
+
+// Warn records a problem found in a file that was mined anyway.
+func (report *ScanReport) Warn(file, reason string) {
+	report.Warnings = append(report.Warnings, ScanFailure{File: file, Reason: reason})
+}
+
+// SaveScanReport stores a report as the result of the last scan, replacing the previous one.
+func (db *DataBase) SaveScanReport(report ScanReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn().Exec(`INSERT OR REPLACE INTO scan_reports (id, report) VALUES (1, ?)`, string(data))
+	return err
+}
+
+// GetLastScanReport returns the report of the last scan. It reports false when the library
+// was never scanned.
+func (db *DataBase) GetLastScanReport() (ScanReport, bool, error) {
+	var data string
+	err := db.conn().QueryRow(`SELECT report FROM scan_reports WHERE id = 1`).Scan(&data)
+	if err == sql.ErrNoRows {
+		return ScanReport{}, false, nil
+	}
+	if err != nil {
+		return ScanReport{}, false, err
+	}
+	var report ScanReport
+	err = json.Unmarshal([]byte(data), &report)
+	return report, err == nil, err
+}
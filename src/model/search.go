@@ -0,0 +1,450 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"database/sql"
+)
+
+// searchIndexColumns are the columns of the FTS5 table, named after the fields they index.
+var searchIndexColumns = []string{"title", "performer", "album", "genre", "album_artist", "composer", "comment"}
+
+// refreshSearchIndex returns the statements that index again the songs selected by where,
+// a condition over 'rolas' aliased as r.
+func refreshSearchIndex(where string) string {
+	return `DELETE FROM songs_fts WHERE rowid IN (SELECT r.id_rola FROM rolas r WHERE ` + where + `);
+		INSERT INTO songs_fts (rowid, ` + strings.Join(searchIndexColumns, ", ") + `)
+			SELECT r.id_rola, r.title, ` + performerNames + `, a.name, r.genre, aa.name, ` + composerNames + `, r.comment
+			` + songsFrom + ` WHERE ` + where + `;`
+}
+
+// searchIndexQueries create the FTS5 table over songs and the triggers that keep it in sync
+// with 'rolas', 'performers', 'albums' and 'credits'.
+var searchIndexQueries = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS songs_fts USING fts5(
+		` + strings.Join(searchIndexColumns, ", ") + `,
+		tokenize = 'unicode61 remove_diacritics 2'
+	);`,
+	`CREATE TRIGGER IF NOT EXISTS rolas_fts_insert AFTER INSERT ON rolas BEGIN
+		` + refreshSearchIndex("r.id_rola = new.id_rola") + `
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS rolas_fts_update
+		AFTER UPDATE OF id_performer, id_album, title, genre, comment ON rolas BEGIN
+		` + refreshSearchIndex("r.id_rola = new.id_rola") + `
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS rolas_fts_delete AFTER DELETE ON rolas BEGIN
+		DELETE FROM songs_fts WHERE rowid = old.id_rola;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS performers_fts_update AFTER UPDATE OF name ON performers BEGIN
+		` + refreshSearchIndex(`r.id_performer = new.id_performer
+			OR r.id_album IN (SELECT id_album FROM albums WHERE id_performer = new.id_performer)
+			OR r.id_rola IN (SELECT id_rola FROM credits WHERE id_performer = new.id_performer)`) + `
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS albums_fts_update AFTER UPDATE OF name, id_performer ON albums BEGIN
+		` + refreshSearchIndex("r.id_album = new.id_album") + `
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS credits_fts_insert AFTER INSERT ON credits BEGIN
+		` + refreshSearchIndex("r.id_rola = new.id_rola") + `
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS credits_fts_delete AFTER DELETE ON credits BEGIN
+		` + refreshSearchIndex("r.id_rola = old.id_rola") + `
+	END;`,
+}
+
+// searchIndexTriggers lists the triggers that write into the FTS5 table.
+var searchIndexTriggers = []string{
+	"rolas_fts_insert", "rolas_fts_update", "rolas_fts_delete", "performers_fts_update", "albums_fts_update",
+	"credits_fts_insert", "credits_fts_delete",
+}
+
+// setupSearchIndex prepares the full-text index. The index only holds derived data, so it is
+// handled outside the schema migrations: when SQLite was built without FTS5 the triggers are
+// dropped so writes keep working, and when FTS5 is available an incomplete or outdated index
+// is built again.
+func setupSearchIndex(db *sql.DB) (bool, error) {
+	var available bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available); err != nil {
+		return false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var triggers int
+	query := `SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name IN (?` +
+		strings.Repeat(", ?", len(searchIndexTriggers)-1) + `)`
+	args := make([]interface{}, len(searchIndexTriggers))
+	for i, name := range searchIndexTriggers {
+		args[i] = name
+	}
+	if err := tx.QueryRow(query, args...).Scan(&triggers); err != nil {
+		return false, err
+	}
+
+	if !available {
+		for _, name := range searchIndexTriggers {
+			if _, err := tx.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+				return false, err
+			}
+		}
+		return false, tx.Commit()
+	}
+	current, err := hasSearchIndexColumns(tx)
+	if err != nil {
+		return false, err
+	}
+	if current && triggers == len(searchIndexTriggers) {
+		return true, nil
+	}
+
+	if !current {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS songs_fts`); err != nil {
+			return false, err
+		}
+	}
+	for _, name := range searchIndexTriggers {
+		if _, err := tx.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+			return false, err
+		}
+	}
+	if err := execAll(tx, searchIndexQueries...); err != nil {
+		return false, err
+	}
+	if err := execAll(tx, `DELETE FROM songs_fts;`, refreshSearchIndex("1")); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// hasSearchIndexColumns reports whether the FTS5 table exists with the current columns.
+func hasSearchIndexColumns(tx *sql.Tx) (bool, error) {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info('songs_fts')`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		columns = append(columns, name)
+	}
+	return strings.Join(columns, ",") == strings.Join(searchIndexColumns, ","), rows.Err()
+}
+
+// HasSearchIndex reports whether the FTS5 index is available for ranked searches.
+func (db *DataBase) HasSearchIndex() bool {
+	return db.searchIndex
+}
+
+// SearchField names a field of the songs that a search can filter on.
+type SearchField string
+
+const (
+	FieldAny         SearchField = ""
+	FieldTitle       SearchField = "title"
+	FieldPerformer   SearchField = "performer"
+	FieldAlbum       SearchField = "album"
+	FieldGenre       SearchField = "genre"
+	FieldYear        SearchField = "year"
+	FieldTrack       SearchField = "track"
+	FieldFormat      SearchField = "format"
+	FieldAlbumArtist SearchField = "album_artist"
+	FieldComposer    SearchField = "composer"
+	FieldComment     SearchField = "comment"
+	FieldDisc        SearchField = "disc"
+	// FieldMissing is not a column: its terms name the field the songs must be missing.
+	FieldMissing     SearchField = "missing"
+)
+
+// textColumns maps the text fields to their SQL columns.
+var textColumns = map[SearchField]string{
+	FieldTitle:       "r.title",
+	FieldPerformer:   performerNames,
+	FieldAlbum:       "a.name",
+	FieldGenre:       "r.genre",
+	FieldAlbumArtist: "aa.name",
+	FieldComposer:    composerNames,
+	FieldComment:     "r.comment",
+}
+
+// anyTextColumns lists the columns matched by a term without a field when there is no
+// FTS5 index.
+var anyTextColumns = []string{"r.title", performerNames, "a.name", "r.genre", "aa.name", composerNames, "r.comment"}
+
+// numberColumns maps the integer fields to their SQL columns.
+var numberColumns = map[SearchField]string{
+	FieldYear:  "r.year",
+	FieldTrack: "r.track",
+	FieldDisc:  "r.disc",
+}
+
+// keywordColumns maps the fields holding a single word, matched whole and ignoring case, to
+// their SQL columns.
+var keywordColumns = map[SearchField]string{
+	FieldFormat: "r.format",
+}
+
+// IsNumeric reports whether the field holds integers, compared instead of matched as text.
+func (field SearchField) IsNumeric() bool {
+	return numberColumns[field] != ""
+}
+
+// SongFilter is a parameterized condition over the songs, where 'rolas' is aliased as r,
+// 'performers' as p, 'albums' as a and the album artist as aa. Rank holds the FTS5 queries whose relevance orders
+// the results.
+type SongFilter struct {
+	Where string
+	Args  []interface{}
+	Rank  []string
+}
+
+// ftsTerm quotes text as an FTS5 string, matching it as a prefix unless it is a phrase.
+func ftsTerm(text string, phrase bool) string {
+	term := `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+	if !phrase {
+		term += "*"
+	}
+	return term
+}
+
+// likePattern builds a LIKE pattern matching text anywhere, escaping its wildcards.
+func likePattern(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(text) + "%"
+}
+
+// TextFilter returns a filter matching text in the given field, or in any text field for
+// FieldAny. With the FTS5 index words match as prefixes; otherwise as substrings. Keyword
+// fields such as the format only match their whole value.
+func (db *DataBase) TextFilter(field SearchField, text string, phrase bool) (SongFilter, error) {
+	if column := keywordColumns[field]; column != "" {
+		return SongFilter{Where: column + ` = ? COLLATE NOCASE`, Args: []interface{}{text}}, nil
+	}
+	if field != FieldAny && textColumns[field] == "" {
+		return SongFilter{}, fmt.Errorf("'%s' is not a text field", field)
+	}
+	if db.searchIndex {
+		match := ftsTerm(text, phrase)
+		if field != FieldAny {
+			match = string(field) + " : " + match
+		}
+		return SongFilter{
+			Where: `r.id_rola IN (SELECT rowid FROM songs_fts WHERE songs_fts MATCH ?)`,
+			Args:  []interface{}{match},
+			Rank:  []string{match},
+		}, nil
+	}
+
+	pattern := likePattern(text)
+	if field != FieldAny {
+		return SongFilter{Where: textColumns[field] + ` LIKE ? ESCAPE '\'`, Args: []interface{}{pattern}}, nil
+	}
+	var conditions []string
+	var args []interface{}
+	for _, column := range anyTextColumns {
+		conditions = append(conditions, column+` LIKE ? ESCAPE '\'`)
+		args = append(args, pattern)
+	}
+	return SongFilter{Where: "(" + strings.Join(conditions, " OR ") + ")", Args: args}, nil
+}
+
+// MissingFields lists the fields whose absence is reported as missing metadata.
+var MissingFields = []SearchField{FieldTitle, FieldPerformer, FieldAlbum, FieldYear, FieldTrack, FieldGenre}
+
+// MissingFilter returns a filter matching the songs without a value in the given field, or
+// without a value in any of MissingFields for FieldAny.
+func (db *DataBase) MissingFilter(field SearchField) (SongFilter, error) {
+	if field == FieldAny {
+		var filters []SongFilter
+		for _, missing := range MissingFields {
+			filter, err := db.MissingFilter(missing)
+			if err != nil {
+				return SongFilter{}, err
+			}
+			filters = append(filters, filter)
+		}
+		return OrFilters(filters...), nil
+	}
+	if column := numberColumns[field]; column != "" {
+		return SongFilter{Where: `IFNULL(` + column + `, 0) = 0`}, nil
+	}
+	column := textColumns[field]
+	if column == "" {
+		column = keywordColumns[field]
+	}
+	if column == "" {
+		return SongFilter{}, fmt.Errorf("'%s' cannot be missing", field)
+	}
+	return SongFilter{Where: `IFNULL(` + column + `, '') = ''`}, nil
+}
+
+// CountMissing returns how many songs are missing each of MissingFields, and under FieldAny
+// how many are missing any of them.
+func (db *DataBase) CountMissing() (map[SearchField]int, error) {
+	counts := make(map[SearchField]int)
+	for _, field := range append([]SearchField{FieldAny}, MissingFields...) {
+		filter, err := db.MissingFilter(field)
+		if err != nil {
+			return nil, err
+		}
+		if counts[field], err = db.CountSongs(filter); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// NumberFilter returns a filter comparing an integer field with a value, using one of the
+// operators =, <, <=, > or >=.
+func (db *DataBase) NumberFilter(field SearchField, operator string, value int) (SongFilter, error) {
+	column := numberColumns[field]
+	if column == "" {
+		return SongFilter{}, fmt.Errorf("'%s' is not a numeric field", field)
+	}
+	switch operator {
+	case "=", "<", "<=", ">", ">=":
+	default:
+		return SongFilter{}, fmt.Errorf("unknown operator '%s'", operator)
+	}
+	return SongFilter{Where: column + " " + operator + " ?", Args: []interface{}{value}}, nil
+}
+
+// combineFilters joins filters with a boolean operator.
+func combineFilters(operator string, filters []SongFilter) SongFilter {
+	var combined SongFilter
+	var conditions []string
+	for _, filter := range filters {
+		conditions = append(conditions, filter.Where)
+		combined.Args = append(combined.Args, filter.Args...)
+		combined.Rank = append(combined.Rank, filter.Rank...)
+	}
+	combined.Where = "(" + strings.Join(conditions, " "+operator+" ") + ")"
+	return combined
+}
+
+// AndFilters returns a filter matching the songs that match every filter.
+func AndFilters(filters ...SongFilter) SongFilter {
+	return combineFilters("AND", filters)
+}
+
+// OrFilters returns a filter matching the songs that match any of the filters.
+func OrFilters(filters ...SongFilter) SongFilter {
+	return combineFilters("OR", filters)
+}
+
+// NotFilter returns a filter matching the songs that do not match the filter. A song whose
+// column is NULL does not match the filter, so it matches its negation with or without the
+// search index. Negated terms never contribute to the relevance.
+func NotFilter(filter SongFilter) SongFilter {
+	return SongFilter{Where: "NOT IFNULL((" + filter.Where + "), 0)", Args: filter.Args}
+}
+
+// SortKey names the field the search results are ordered by.
+type SortKey string
+
+const (
+	SortRelevance SortKey = ""
+	SortTitle     SortKey = "title"
+	SortArtist    SortKey = "artist"
+	SortAlbum     SortKey = "album"
+	SortYear      SortKey = "year"
+	SortTrack     SortKey = "track"
+)
+
+// SortKeys lists the available sort keys in the order they are offered to the user.
+var SortKeys = []SortKey{SortRelevance, SortTitle, SortArtist, SortAlbum, SortYear, SortTrack}
+
+// sortColumns maps each sort key to its main column and the columns that break ties.
+var sortColumns = map[SortKey][]string{
+	SortTitle:  {"r.title COLLATE NOCASE"},
+	SortArtist: {"p.name COLLATE NOCASE", "a.name COLLATE NOCASE", "r.disc", "r.track"},
+	SortAlbum:  {"a.name COLLATE NOCASE", "r.disc", "r.track"},
+	SortYear:   {"r.year", "r.title COLLATE NOCASE"},
+	SortTrack:  {"r.track", "r.title COLLATE NOCASE"},
+}
+
+// SearchOptions controls the order and the page of the search results. A zero Limit returns
+// every result.
+type SearchOptions struct {
+	SortBy     SortKey
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+// orderBy builds the ORDER BY clause for the options, with its arguments. Sorting by relevance
+// needs full-text terms in the filter and falls back to the title otherwise. The song ID is
+// always the last key so pages are stable.
+func (db *DataBase) orderBy(filter SongFilter, options SearchOptions) (string, []interface{}) {
+	direction := " ASC"
+	if options.Descending {
+		direction = " DESC"
+	}
+
+	var args []interface{}
+	var keys []string
+	if columns, ok := sortColumns[options.SortBy]; ok {
+		keys = append(keys, columns[0]+direction)
+		keys = append(keys, columns[1:]...)
+	} else if len(filter.Rank) > 0 && db.searchIndex {
+		keys = append(keys, `IFNULL((SELECT bm25(songs_fts, 10.0, 5.0, 5.0, 1.0) FROM songs_fts
+			WHERE songs_fts MATCH ? AND rowid = r.id_rola), 0)`+direction, "r.title COLLATE NOCASE")
+		args = append(args, "("+strings.Join(filter.Rank, ") OR (")+")")
+	} else {
+		keys = append(keys, "r.title COLLATE NOCASE"+direction)
+	}
+	keys = append(keys, "r.id_rola")
+	return " ORDER BY " + strings.Join(keys, ", "), args
+}
+
+// FilterSongs returns one page of the songs matching the filter, ordered as the options say.
+// Every song appears once, since the filter is evaluated over the rows of 'rolas' and the
+// joined performer and album are unique per song.
+func (db *DataBase) FilterSongs(filter SongFilter, options SearchOptions) ([]Song, error) {
+	query := songColumns + songsFrom + ` WHERE ` + filter.Where
+	args := append([]interface{}{}, filter.Args...)
+
+	order, orderArgs := db.orderBy(filter, options)
+	query += order
+	args = append(args, orderArgs...)
+	if options.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, options.Limit, options.Offset)
+	}
+
+	return db.querySongs(query, args...)
+}
+
+// CountSongs returns how many songs match the filter.
+func (db *DataBase) CountSongs(filter SongFilter) (int, error) {
+	var count int
+	err := db.conn().QueryRow(`SELECT count(*) `+songsFrom+` WHERE `+filter.Where, filter.Args...).Scan(&count)
+	return count, err
+}
+
+// FullTextSearch searches songs whose title, performer, album or genre contain every word of
+// the text as a prefix. With the FTS5 index the results are ordered by BM25 relevance, giving
+// titles more weight; otherwise it falls back to LIKE matching ordered by title.
+func (db *DataBase) FullTextSearch(text string) ([]Song, error) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	var filters []SongFilter
+	for _, word := range words {
+		filter, err := db.TextFilter(FieldAny, word, false)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return db.FilterSongs(AndFilters(filters...), SearchOptions{})
+}
@@ -1,6 +1,10 @@
 package model
 
-// Song represents a musical track with its metadata.
+import "time"
+
+// Song represents a musical track with its metadata and the properties of its audio. Artists
+// are the names of its artists besides its performer, and Featured those of the performers
+// featured in it, both separated by semicolons like Composer.
 type Song struct {
 	ID int64
 	PerformerID int64
@@ -10,6 +14,38 @@ type Song struct {
 	Track      int
 	Year       int
 	Genre      string
+	Missing    bool
+	Format     string
+	Disc       int
+	Comment    string
+	Composer   string
+	Artists    string
+	Featured   string
+	Duration   time.Duration
+	Bitrate    int
+	SampleRate int
+	Channels   string
+	VBR        bool
+	Encoder    string
 	PerformerName string
+	PerformerType int
 	AlbumName string
-}
\ No newline at end of file
+	AlbumPath string
+	AlbumYear int
+	AlbumArtistID int64
+	AlbumArtistName string
+	Cover string
+	AlbumCover string
+}
+
+// Audio returns the properties of the song's audio.
+func (song Song) Audio() AudioProperties {
+	return AudioProperties{
+		Duration: song.Duration,
+		Bitrate: song.Bitrate,
+		SampleRate: song.SampleRate,
+		Channels: song.Channels,
+		VBR: song.VBR,
+		Encoder: song.Encoder,
+	}
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchDirectory watches a directory and all of its subdirectories until the context is done.
+// The paths of the files and directories that were created, written, renamed or removed are
+// collected until no event arrives for the given delay, and then handed to flush all at once,
+// so a burst of writes or the two halves of a rename are handled together.
+func WatchDirectory(ctx context.Context, directory string, delay time.Duration, flush func(paths []string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watchTree(watcher, directory); err != nil {
+		return err
+	}
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(delay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						log.Printf("Error watching %s: %v", event.Name, err)
+					}
+				}
+			}
+			pending[event.Name] = true
+			timer.Reset(delay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Error watching %s: %v", directory, err)
+		case <-timer.C:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			pending = make(map[string]bool)
+			flush(paths)
+		}
+	}
+}
+
+// watchTree adds a directory and its subdirectories to the watcher.
+func watchTree(watcher *fsnotify.Watcher, directory string) error {
+	return filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"testing"
+	"context"
+	"os"
+	"path/filepath"
+	"github.com/KevinJGard/MusicDB/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtistSplitter(t *testing.T) {
+	splitter := model.DefaultArtistSplitter()
+	tests := []struct {
+		artist   string
+		primary  []string
+		featured []string
+	}{
+		{"Daft Punk", []string{"Daft Punk"}, nil},
+		{"Daft Punk feat. Pharrell Williams", []string{"Daft Punk"}, []string{"Pharrell Williams"}},
+		{"Daft Punk (Feat. Pharrell Williams & Nile Rodgers)", []string{"Daft Punk"}, []string{"Pharrell Williams", "Nile Rodgers"}},
+		{"A & B; C ft. D", []string{"A", "B", "C"}, []string{"D"}},
+		{"A\x00B feat. C\x00\ufeffD", []string{"A", "B", "D"}, []string{"C"}},
+		{"Loft. Featuringham", []string{"Loft. Featuringham"}, nil},
+		{"feat. A", []string{"A"}, nil},
+		{"A & a feat. A", []string{"A"}, nil},
+	}
+	for _, test := range tests {
+		primary, featured := splitter.Split(test.artist)
+		assert.Equal(t, test.primary, primary, "Expected the primary artists of %q.", test.artist)
+		assert.Equal(t, test.featured, featured, "Expected the featured artists of %q.", test.artist)
+	}
+
+	splitter = model.ArtistSplitter{Separators: []string{""}, Featured: []string{" with "}}
+	primary, featured := splitter.Split("Simon & Garfunkel With Paul")
+	assert.Equal(t, []string{"Simon & Garfunkel"}, primary, "Expected only the configured separators to split.")
+	assert.Equal(t, []string{"Paul"}, featured, "Expected the configured featured separator to split.")
+}
+
+func TestArtistSplitterJoin(t *testing.T) {
+	splitter := model.DefaultArtistSplitter()
+	joined := splitter.Join([]string{"A", "B"}, []string{"C", "D"})
+	assert.Equal(t, "A & B feat. C & D", joined, "Expected the first separators to join the artists.")
+	primary, featured := splitter.Split(joined)
+	assert.Equal(t, []string{"A", "B"}, primary, "Expected the joined artists to split back.")
+	assert.Equal(t, []string{"C", "D"}, featured, "Expected the joined artists to split back.")
+
+	splitter = model.ArtistSplitter{Separators: []string{";"}}
+	assert.Equal(t, "A; B feat. C", splitter.Join([]string{"A", "B"}, []string{"C"}), "Expected the default featured separator.")
+}
+
+func TestControllerMineMetadataArtists(t *testing.T) {
+	c := setupMiningController(t, nil)
+	duoID, err := c.DB.InsertPerformerIfNotExists("Simon & Garfunkel", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+	err = c.DefGroup(duoID, "Simon & Garfunkel", "1956", "1970")
+	assert.NoError(t, err, "Failed defining the group.")
+
+	artists := map[string]string{
+		"split.mp3": "Daft Punk\x00Justice feat. Pharrell Williams",
+		"whole.mp3": "Simon & Garfunkel",
+	}
+	for name, artist := range artists {
+		file := filepath.Join(c.Config.MusicDirectory, name)
+		err := os.WriteFile(file, mpegStream(mpegFrame(), 9), 0644)
+		assert.NoError(t, err, "Failed writing the file.")
+		err = model.WriteID3Tags(file, model.ID3Tags{Title: name, Artist: artist}, 4)
+		assert.NoError(t, err, "Failed writing the tags.")
+	}
+	_, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+
+	songs, err := c.DB.SearchByTitle("split.mp3")
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Len(t, songs, 1, "Expected the song to be mined.")
+	song := songs[0]
+	assert.Equal(t, "Daft Punk", song.PerformerName, "Expected the first artist to be the performer.")
+	assert.Equal(t, "Justice", song.Artists, "Expected the other artist to be credited.")
+	assert.Equal(t, "Pharrell Williams", song.Featured, "Expected the featured artist to be credited.")
+	assert.Equal(t, "Daft Punk & Justice feat. Pharrell Williams", c.ArtistCredit(song), "Expected every artist in the credit.")
+	wholeID, err := c.DB.GetPerformerID("Daft Punk\x00Justice feat. Pharrell Williams")
+	assert.NoError(t, err, "Expected no error getting the performer ID.")
+	assert.Zero(t, wholeID, "Expected no performer named after the whole tag.")
+
+	songs, err = c.DB.SearchByPerformer("Pharrell")
+	assert.NoError(t, err, "Expected no error searching by performer.")
+	assert.Len(t, songs, 1, "Expected a featured artist to be found.")
+	songs, err = c.GetSearchSongs("ar:justice", model.SearchOptions{})
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Len(t, songs, 1, "Expected a credited artist to be found.")
+
+	songs, err = c.DB.SearchByTitle("whole.mp3")
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Len(t, songs, 1, "Expected the song to be mined.")
+	assert.Equal(t, duoID, songs[0].PerformerID, "Expected a defined performer to be kept whole.")
+	assert.Empty(t, songs[0].Artists, "Expected a defined performer to be the only artist.")
+
+	err = c.WriteSongTags(song.ID)
+	assert.NoError(t, err, "Expected no error writing the tags.")
+	metadata, err := c.Miner.ReadTags(song.Path)
+	assert.NoError(t, err, "Expected no error reading the written tags.")
+	assert.Equal(t, "Daft Punk & Justice feat. Pharrell Williams", metadata.Artist, "Expected every artist to be written.")
+}
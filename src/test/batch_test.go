@@ -0,0 +1,83 @@
+package test
+
+import (
+	"testing"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	c := setupMiningController(t, nil)
+	db := c.DB
+	var mode string
+	err := db.Db.QueryRow(`PRAGMA journal_mode`).Scan(&mode)
+	assert.NoError(t, err, "Expected no error reading the journal mode.")
+	assert.Equal(t, "wal", mode, "Expected the database to use write-ahead logging.")
+
+	batch, err := db.Begin()
+	assert.NoError(t, err, "Expected no error beginning a batch.")
+	_, err = batch.Begin()
+	assert.Error(t, err, "Expected an error beginning a batch inside a batch.")
+	id, err := batch.InsertPerformerIfNotExists("Kept", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+	assert.NotZero(t, id, "Expected the ID of the inserted performer.")
+	again, err := batch.InsertPerformerIfNotExists("Kept", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+	assert.Equal(t, id, again, "Expected the ID of the existing performer.")
+	duplicateID, err := batch.InsertPerformerIfNotExists("Duplicate", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+	err = batch.MergePerformers(id, []int64{duplicateID, id})
+	assert.Error(t, err, "Expected an error merging a performer into itself.")
+	_, err = batch.GetPerformer(duplicateID)
+	assert.NoError(t, err, "Expected a failed write to be undone.")
+	_, err = batch.GetPerformer(id)
+	assert.NoError(t, err, "Expected a failed write to keep the rest of the batch.")
+	assert.NoError(t, batch.Commit(), "Expected no error committing the batch.")
+	assert.NoError(t, batch.Rollback(), "Expected rolling back a committed batch to do nothing.")
+	_, err = db.GetPerformer(id)
+	assert.NoError(t, err, "Expected the committed performer to be stored.")
+
+	batch, err = db.Begin()
+	assert.NoError(t, err, "Expected no error beginning a batch.")
+	discarded, err := batch.InsertPerformerIfNotExists("Discarded", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+	assert.NoError(t, batch.Rollback(), "Expected no error rolling back the batch.")
+	_, err = db.GetPerformer(discarded)
+	assert.Error(t, err, "Expected the rolled back performer not to be stored.")
+}
+
+func TestControllerMineMetadataBatches(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3", "test2.mp3", "test3.mp3"})
+	c.Config.BatchSize = 2
+	report, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	assert.Equal(t, 3, report.Scanned, "Expected every file to be scanned.")
+
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 3, "Expected the files of every batch to be stored.")
+}
+
+func TestControllerMineMetadataConcurrentWrites(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3", "test2.mp3", "test3.mp3", "test4.mp3"})
+	dbFile := filepath.Join(os.Getenv("HOME"), ".local", "share", "MusicDB", "music.db")
+	other, err := sql.Open("sqlite3", dbFile+"?_busy_timeout=100")
+	assert.NoError(t, err, "Failed opening a second connection.")
+	defer other.Close()
+
+	writes := 0
+	_, err = c.MineMetadata(context.Background(), func(int) {
+		_, err := other.Exec(`INSERT INTO performers (id_type, name) VALUES (2, 'Writer')`)
+		assert.NoError(t, err, "Expected the database to be writable while files are parsed.")
+		writes++
+	}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	assert.Equal(t, 4, writes, "Expected a write for every parsed file.")
+
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 4, "Expected every file to be stored.")
+}
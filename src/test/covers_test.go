@@ -0,0 +1,165 @@
+package test
+
+import (
+	"testing"
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"github.com/KevinJGard/MusicDB/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	var data bytes.Buffer
+	err := png.Encode(&data, image.NewRGBA(image.Rect(0, 0, width, height)))
+	assert.NoError(t, err, "Failed to encode the picture.")
+	return data.Bytes()
+}
+
+func TestCoverCache(t *testing.T) {
+	cache := &model.CoverCache{Dir: t.TempDir(), ThumbnailSize: 100}
+	picture := encodePNG(t, 400, 200)
+
+	hash, err := cache.Store(picture)
+	assert.NoError(t, err, "Expected no error storing the picture.")
+	assert.Len(t, hash, 64, "Expected the picture to be named by its SHA-256.")
+	stored, err := os.ReadFile(cache.Path(hash))
+	assert.NoError(t, err, "Expected the picture to be stored.")
+	assert.Equal(t, picture, stored, "Expected the picture to be stored as it is.")
+
+	file, err := os.Open(cache.ThumbnailPath(hash))
+	assert.NoError(t, err, "Expected the thumbnail to be stored.")
+	defer file.Close()
+	thumbnail, _, err := image.DecodeConfig(file)
+	assert.NoError(t, err, "Expected the thumbnail to be a picture.")
+	assert.Equal(t, 100, thumbnail.Width, "Expected the thumbnail to fit in its size.")
+	assert.Equal(t, 50, thumbnail.Height, "Expected the thumbnail to keep the proportions.")
+
+	again, err := cache.Store(picture)
+	assert.NoError(t, err, "Expected no error storing the picture again.")
+	assert.Equal(t, hash, again, "Expected the same picture to have the same hash.")
+	_, err = cache.Store([]byte("not a picture"))
+	assert.Error(t, err, "Expected an error storing something that is not a picture.")
+}
+
+func TestStoreDirectoryCover(t *testing.T) {
+	cache := &model.CoverCache{Dir: t.TempDir(), ThumbnailSize: 100}
+	dir := t.TempDir()
+
+	hash, err := cache.StoreDirectoryCover(dir)
+	assert.NoError(t, err, "Expected no error for a directory without a cover.")
+	assert.Empty(t, hash, "Expected no cover for a directory without one.")
+
+	err = os.WriteFile(filepath.Join(dir, "Folder.PNG"), encodePNG(t, 10, 10), 0644)
+	assert.NoError(t, err, "Failed to write the cover.")
+	hash, err = cache.StoreDirectoryCover(dir)
+	assert.NoError(t, err, "Expected no error storing the directory cover.")
+	assert.NotEmpty(t, hash, "Expected the cover to be found in any case.")
+	assert.FileExists(t, cache.ThumbnailPath(hash), "Expected the thumbnail to be stored.")
+}
+
+func TestControllerMineMetadataCovers(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3"})
+	untagged := filepath.Join(c.Config.MusicDirectory, "Other", "untagged.mp3")
+	err := os.MkdirAll(filepath.Dir(untagged), os.ModePerm)
+	assert.NoError(t, err, "Failed to create the album directory.")
+	err = os.WriteFile(untagged, append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 413)...), 0644)
+	assert.NoError(t, err, "Failed to create the untagged file.")
+	err = model.WriteID3Tags(untagged, model.ID3Tags{Title: "Untagged", Album: "Other"}, 4)
+	assert.NoError(t, err, "Failed to tag the file.")
+	err = os.WriteFile(filepath.Join(filepath.Dir(untagged), "cover.png"), encodePNG(t, 10, 10), 0644)
+	assert.NoError(t, err, "Failed to write the album cover.")
+
+	_, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 2, "Expected both files to be inserted.")
+
+	for _, song := range songs {
+		thumbnail := c.CoverThumbnail(song)
+		assert.FileExists(t, thumbnail, "Expected a thumbnail for %s.", song.Path)
+		if song.Title == "Untagged" {
+			assert.Empty(t, song.Cover, "Expected no embedded picture.")
+			assert.NotEmpty(t, song.AlbumCover, "Expected the album cover to come from its directory.")
+		} else {
+			assert.NotEmpty(t, song.Cover, "Expected the embedded picture to be cached.")
+			assert.Equal(t, song.Cover, song.AlbumCover, "Expected the album cover to be the embedded picture.")
+		}
+	}
+}
+
+// id3v23Frame returns an ID3v2.3 frame holding data.
+func id3v23Frame(id string, data []byte) []byte {
+	return append(append([]byte(id), 0, 0, 0, byte(len(data)), 0, 0), data...)
+}
+
+func TestControllerMineMetadataCoverWarnings(t *testing.T) {
+	c := setupMiningController(t, nil)
+	frames := append(id3v23Frame("TIT2", []byte("\x00Bad")), id3v23Frame("TALB", []byte("\x00Album"))...)
+	frames = append(frames, id3v23Frame("APIC", []byte("\x00image/png\x00\x03\x00not a picture"))...)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frames))}, frames...)
+	dir := filepath.Join(c.Config.MusicDirectory, "Album")
+	err := os.MkdirAll(dir, os.ModePerm)
+	assert.NoError(t, err, "Failed to create the album directory.")
+	file := filepath.Join(dir, "bad.mp3")
+	err = os.WriteFile(file, append(tag, mpegStream(mpegFrame(), 9)...), 0644)
+	assert.NoError(t, err, "Failed to write the file.")
+	err = os.WriteFile(filepath.Join(dir, "cover.png"), []byte("not a picture"), 0644)
+	assert.NoError(t, err, "Failed to write the album cover.")
+
+	report, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	assert.Equal(t, 1, report.Added, "Expected a file with a broken picture to be mined.")
+	assert.Zero(t, report.Failed, "Expected a broken picture not to fail the file.")
+	var warned []string
+	for _, warning := range report.Warnings {
+		warned = append(warned, warning.File)
+	}
+	assert.ElementsMatch(t, []string{file, dir}, warned, "Expected the broken pictures to be warnings in the report.")
+}
+
+func TestControllerMineMetadataKeepsDirectoryCovers(t *testing.T) {
+	c := setupMiningController(t, nil)
+	dir := filepath.Join(c.Config.MusicDirectory, "Album")
+	err := os.MkdirAll(dir, os.ModePerm)
+	assert.NoError(t, err, "Failed to create the album directory.")
+	writeSong := func(name string, frames []byte) {
+		frames = append(frames, id3v23Frame("TALB", []byte("\x00Album"))...)
+		tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frames))}, frames...)
+		err := os.WriteFile(filepath.Join(dir, name), append(tag, mpegStream(mpegFrame(), 9)...), 0644)
+		assert.NoError(t, err, "Failed to write the file.")
+	}
+	albumCovers := func() map[string]string {
+		_, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+		assert.NoError(t, err, "Expected no error mining metadata.")
+		songs, err := c.GetSongs()
+		assert.NoError(t, err, "Expected no error getting songs.")
+		covers := make(map[string]string)
+		for _, song := range songs {
+			covers[song.Title] = song.AlbumCover
+		}
+		return covers
+	}
+	writeSong("first.mp3", id3v23Frame("TIT2", []byte("\x00First")))
+	err = os.WriteFile(filepath.Join(dir, "cover.png"), encodePNG(t, 10, 10), 0644)
+	assert.NoError(t, err, "Failed to write the album cover.")
+	directoryCover := albumCovers()["First"]
+	assert.NotEmpty(t, directoryCover, "Expected the album cover to come from its directory.")
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "cover.png")), "Failed to remove the album cover.")
+	writeSong("second.mp3", id3v23Frame("TIT2", []byte("\x00Second")))
+	covers := albumCovers()
+	assert.Equal(t, map[string]string{"First": directoryCover, "Second": directoryCover}, covers,
+		"Expected the album to keep its directory cover.")
+
+	picture := append([]byte("\x00image/png\x00\x03\x00"), encodePNG(t, 1, 1)...)
+	writeSong("third.mp3", append(id3v23Frame("TIT2", []byte("\x00Third")), id3v23Frame("APIC", picture)...))
+	covers = albumCovers()
+	assert.NotEqual(t, directoryCover, covers["Third"], "Expected the embedded picture to replace the directory cover.")
+	assert.NotEmpty(t, covers["Third"], "Expected the album cover to be the embedded picture.")
+	assert.Equal(t, covers["Third"], covers["First"], "Expected every song of the album to share its cover.")
+}
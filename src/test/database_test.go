@@ -440,6 +440,122 @@ func TestInsertPersonInGroup(t *testing.T) {
 	assert.NoError(t, err, "Failed inserting in_group.")
 }
 
+func TestLinkPerson(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Db.Close()
+
+	performerID, err := db.InsertPerformerIfNotExists("Test Performer", 2)
+	assert.NoError(t, err, "Failed inserting performer.")
+	_, ok, err := db.GetPersonByPerformer(performerID)
+	assert.NoError(t, err, "Expected no error getting the person.")
+	assert.False(t, ok, "Expected an undefined performer not to be a person.")
+
+	personID, err := db.InsertPersonIfNotExists("Test Performer", "Real Name", "1950", "0")
+	assert.NoError(t, err, "Failed inserting person.")
+	err = db.LinkPerson(performerID, personID)
+	assert.NoError(t, err, "Expected no error linking the person.")
+	person, ok, err := db.GetPersonByPerformer(performerID)
+	assert.NoError(t, err, "Expected no error getting the person.")
+	assert.True(t, ok, "Expected the performer to be a person.")
+	assert.Equal(t, "Real Name", person.RealName, "Expected the details of the linked person.")
+	performer, err := db.GetPerformer(performerID)
+	assert.NoError(t, err, "Expected no error getting the performer.")
+	assert.Equal(t, 0, performer.Type, "Expected the performer to be typed as a person.")
+
+	groupID, err := db.InsertGroupIfNotExists("Test Performer", "1970", "0")
+	assert.NoError(t, err, "Failed inserting group.")
+	err = db.LinkGroup(performerID, groupID)
+	assert.NoError(t, err, "Expected no error linking the group.")
+	_, ok, err = db.GetPersonByPerformer(performerID)
+	assert.NoError(t, err, "Expected no error getting the person.")
+	assert.False(t, ok, "Expected the person to be unlinked.")
+	group, ok, err := db.GetGroupByPerformer(performerID)
+	assert.NoError(t, err, "Expected no error getting the group.")
+	assert.True(t, ok, "Expected the performer to be a group.")
+	assert.Equal(t, "1970", group.StartDate, "Expected the details of the linked group.")
+}
+
+func TestControllerPerformerDetails(t *testing.T) {
+	c := setupMiningController(t, nil)
+	singerID, err := c.DB.InsertPerformerIfNotExists("Singer", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+	bandID, err := c.DB.InsertPerformerIfNotExists("Band", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+
+	err = c.DefGroup(bandID, "Band", "1980", "1990")
+	assert.NoError(t, err, "Expected no error defining the group.")
+	err = c.DefPerson(singerID, "Singer", "Real", "1960", "0")
+	assert.NoError(t, err, "Expected no error defining the person.")
+	band, err := c.GetPerformerDetails(bandID)
+	assert.NoError(t, err, "Expected no error getting the details.")
+	details, err := c.GetPerformerDetails(singerID)
+	assert.NoError(t, err, "Expected no error getting the details.")
+	err = c.AddMember(details.Person.ID, band.Group.ID, "", "", "")
+	assert.NoError(t, err, "Expected no error adding the person to the group.")
+
+	details, err = c.GetPerformerDetails(singerID)
+	assert.NoError(t, err, "Expected no error getting the details.")
+	assert.Equal(t, "Singer", details.Name, "Expected the performer's name.")
+	assert.NotNil(t, details.Person, "Expected the person's details.")
+	assert.Nil(t, details.Group, "Expected a person not to be a group.")
+	assert.Equal(t, "1960", details.Person.BirthDate, "Expected the birth date to be kept.")
+	assert.Len(t, details.Groups, 1, "Expected the person's group.")
+	assert.Equal(t, "Band", details.Groups[0].Name, "Expected the person's group.")
+
+	err = c.DefPerson(singerID, "Singer", "Other", "1961", "0")
+	assert.NoError(t, err, "Expected no error editing the person.")
+	details, err = c.GetPerformerDetails(singerID)
+	assert.NoError(t, err, "Expected no error getting the details.")
+	assert.Equal(t, "Other", details.Person.RealName, "Expected the person to be edited.")
+	assert.Len(t, details.Groups, 1, "Expected the edited person to stay in the group.")
+
+	details, err = c.GetPerformerDetails(bandID)
+	assert.NoError(t, err, "Expected no error getting the details.")
+	assert.NotNil(t, details.Group, "Expected the group's details.")
+	assert.Equal(t, "1990", details.Group.EndDate, "Expected the end date to be kept.")
+}
+
+func TestMembership(t *testing.T) {
+	c := setupMiningController(t, nil)
+	singerID, err := c.DB.InsertPersonIfNotExists("Singer", "Real", "1960", "0")
+	assert.NoError(t, err, "Failed inserting person.")
+	drummerID, err := c.DB.InsertPersonIfNotExists("Drummer", "Real", "1962", "0")
+	assert.NoError(t, err, "Failed inserting person.")
+	bandID, err := c.DB.InsertGroupIfNotExists("Band", "1980", "1990")
+	assert.NoError(t, err, "Failed inserting group.")
+
+	err = c.AddMember(0, bandID, "", "", "")
+	assert.Error(t, err, "Expected an error adding no person.")
+	err = c.AddMember(singerID, bandID, "1980", "", " vocals ")
+	assert.NoError(t, err, "Expected no error adding the singer.")
+	err = c.AddMember(drummerID, bandID, "", "", "")
+	assert.NoError(t, err, "Expected no error adding the drummer.")
+	err = c.AddMember(singerID, bandID, "1980", "1985", "vocals, guitar")
+	assert.NoError(t, err, "Expected no error updating the singer.")
+
+	members, err := c.GetGroupMembers(bandID)
+	assert.NoError(t, err, "Expected no error getting the members.")
+	assert.Len(t, members, 2, "Expected a person added twice to be a member once.")
+	assert.Equal(t, "Drummer", members[0].PersonName, "Expected members without a date first.")
+	assert.Equal(t, model.Membership{PersonID: singerID, GroupID: bandID, PersonName: "Singer", GroupName: "Band",
+		StartDate: "1980", EndDate: "1985", Role: "vocals, guitar"}, members[1], "Expected the updated membership.")
+
+	memberships, err := c.GetPersonMemberships(drummerID)
+	assert.NoError(t, err, "Expected no error getting the memberships.")
+	assert.Len(t, memberships, 1, "Expected the drummer's group.")
+	assert.Equal(t, "Band", memberships[0].GroupName, "Expected the drummer's group.")
+	assert.Empty(t, memberships[0].Role, "Expected no role for the drummer.")
+
+	err = c.RemoveMember(drummerID, bandID)
+	assert.NoError(t, err, "Expected no error removing the drummer.")
+	members, err = c.GetGroupMembers(bandID)
+	assert.NoError(t, err, "Expected no error getting the members.")
+	assert.Len(t, members, 1, "Expected the drummer to be removed.")
+	persons, err := c.GetPersons()
+	assert.NoError(t, err, "Expected no error getting the persons.")
+	assert.Len(t, persons, 2, "Expected the removed member to remain a person.")
+}
+
 func assertInsert(t *testing.T, db *model.DataBase) {
 	performer := &model.Performer{Name: "Test Performer", Type: 1}
     performerID, err := db.InsertPerformerIfNotExists(performer.Name, performer.Type)
@@ -508,4 +624,119 @@ func TestSearchByGenre(t *testing.T) {
 	assert.NoError(t, err, "Expected no error searching by year.")
 	assert.Len(t, songs, 1, "Expected one song returned.")
 	assert.Equal(t, "song1", songs[0].Title, "Expected song title to match.")
-}
\ No newline at end of file
+}
+func TestGetAllSongs(t *testing.T) {
+	db := setupTestDB(t)
+	assertInsert(t, db)
+
+	songs, err := db.GetAllSongs()
+	assert.NoError(t, err, "Expected no error getting all songs.")
+	assert.Len(t, songs, 1, "Expected one song returned.")
+	song := songs[0]
+	assert.Equal(t, "Test Performer", song.PerformerName, "Expected performer name to match.")
+	assert.Equal(t, 1, song.PerformerType, "Expected performer type to match.")
+	assert.Equal(t, "Test Album", song.AlbumName, "Expected album name to match.")
+	assert.Equal(t, "/path/test", song.AlbumPath, "Expected album path to match.")
+	assert.Equal(t, 1901, song.AlbumYear, "Expected album year to match.")
+}
+
+func TestGetSong(t *testing.T) {
+	db := setupTestDB(t)
+	assertInsert(t, db)
+
+	song, err := db.GetSong(1)
+	assert.NoError(t, err, "Expected no error getting the song.")
+	assert.Equal(t, "song1", song.Title, "Expected song title to match.")
+	assert.Equal(t, "Test Album", song.AlbumName, "Expected album name to match.")
+
+	_, err = db.GetSong(999)
+	assert.Error(t, err, "Expected an error getting a missing song.")
+}
+
+func TestMarkMissingUnder(t *testing.T) {
+	db := setupTestDB(t)
+	paths := []string{"/music/Café del Mar/1.mp3", "/music/Café del Mar/CD 2/2.mp3", "/music/Café del Mar 2/3.mp3", "/music/Café.mp3"}
+	for _, path := range paths {
+		err := db.InsertSong(&model.Song{Path: path, Title: path})
+		assert.NoError(t, err, "Failed inserting song.")
+	}
+
+	marked, err := db.MarkMissingUnder("/music/Café del Mar/")
+	assert.NoError(t, err, "Expected no error marking the songs missing.")
+	assert.Equal(t, int64(2), marked, "Expected the songs inside a non-ASCII directory to be marked.")
+	marked, err = db.MarkMissingUnder("/music/Café.mp3")
+	assert.NoError(t, err, "Expected no error marking the song missing.")
+	assert.Equal(t, int64(1), marked, "Expected the song of a removed file to be marked.")
+	state, _, err := db.GetFileState("/music/Café del Mar 2/3.mp3")
+	assert.NoError(t, err, "Expected no error getting the file state.")
+	assert.False(t, state.Missing, "Expected a directory sharing the prefix not to be marked.")
+}
+
+func TestGetOrInsertAlbum(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Db.Close()
+	artistID, err := db.InsertPerformerIfNotExists("Test Artist", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+
+	first, err := db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "Greatest Hits", 2000, 0, "/music/a/01.mp3")
+	assert.NoError(t, err, "Failed inserting album.")
+	same, err := db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "Greatest Hits", 2001, 0, "/music/a/02.mp3")
+	assert.NoError(t, err, "Failed getting album.")
+	assert.Equal(t, first, same, "Expected songs in the same directory to share the album.")
+	other, err := db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "Greatest Hits", 2000, 0, "/music/b/01.mp3")
+	assert.NoError(t, err, "Failed inserting album.")
+	assert.NotEqual(t, first, other, "Expected albums in other directories to be different.")
+	byArtist, err := db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "Greatest Hits", 2000, artistID, "/music/a/03.mp3")
+	assert.NoError(t, err, "Failed inserting album.")
+	assert.NotEqual(t, first, byArtist, "Expected albums of other artists to be different.")
+
+	same, err = db.GetOrInsertAlbum(model.AlbumByArtist, "Greatest Hits", 2000, artistID, "/music/c/01.mp3")
+	assert.NoError(t, err, "Failed getting album.")
+	assert.Equal(t, byArtist, same, "Expected the artist strategy to ignore the directory.")
+	same, err = db.GetOrInsertAlbum(model.AlbumByDirectory, "Greatest Hits", 2000, artistID, "/music/b/02.mp3")
+	assert.NoError(t, err, "Failed getting album.")
+	assert.Equal(t, other, same, "Expected the directory strategy to ignore the album artist.")
+}
+
+func TestRegroupAlbums(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Db.Close()
+	insertAlbum := func(year int) int64 {
+		id, err := db.InsertAlbumIfNotExists("Greatest Hits", year, "/music/a")
+		assert.NoError(t, err, "Failed inserting album.")
+		return id
+	}
+	insertSong := func(album int64, path string) int64 {
+		song := &model.Song{AlbumID: album, Path: path, Title: filepath.Base(path)}
+		assert.NoError(t, db.InsertSong(song), "Failed inserting song.")
+		id, err := db.GetSongIDByPath(path)
+		assert.NoError(t, err, "Failed getting song.")
+		return id
+	}
+	album := insertAlbum(2000)
+	split := insertSong(album, "/music/b/01.mp3")
+	kept := insertSong(album, "/music/a/01.mp3")
+	emptied := insertAlbum(2001)
+	merged := insertSong(emptied, "/music/b/02.mp3")
+
+	touched, err := db.RegroupAlbums(model.AlbumByArtistAndDirectory)
+	assert.NoError(t, err, "Expected no error regrouping albums.")
+
+	songs := map[int64]model.Song{}
+	for _, id := range []int64{split, kept, merged} {
+		songs[id], err = db.GetSong(id)
+		assert.NoError(t, err, "Failed getting song.")
+	}
+	assert.Equal(t, album, songs[split].AlbumID, "Expected the first group to keep the album.")
+	assert.Equal(t, "/music/b", songs[split].AlbumPath, "Expected the album path to follow its songs.")
+	assert.NotEqual(t, album, songs[kept].AlbumID, "Expected songs in another directory to be split.")
+	assert.Equal(t, "/music/a", songs[kept].AlbumPath, "Expected the split album in its directory.")
+	assert.Equal(t, album, songs[merged].AlbumID, "Expected songs in the same directory to be merged.")
+	assert.ElementsMatch(t, []int64{album, songs[kept].AlbumID, emptied}, touched,
+		"Expected the IDs of the albums whose songs or directory changed.")
+
+	var albums int
+	err = db.Db.QueryRow(`SELECT count(*) FROM albums`).Scan(&albums)
+	assert.NoError(t, err, "Expected no error counting albums.")
+	assert.Equal(t, 2, albums, "Expected merged albums to be deleted.")
+}
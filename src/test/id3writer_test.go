@@ -0,0 +1,107 @@
+package test
+
+import (
+	"testing"
+	"context"
+	"os"
+	"path/filepath"
+	"github.com/KevinJGard/MusicDB/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteID3Tags(t *testing.T) {
+	tempDir := t.TempDir()
+	err := copyMp3(tempDir, "test.mp3")
+	assert.NoError(t, err, "Failed to copy the mp3 file.")
+	file := filepath.Join(tempDir, "test.mp3")
+
+	tags := model.ID3Tags{Title: "New Title", Artist: "New Artist", Album: "New Album", Year: 2001, Track: 3}
+	err = model.WriteID3Tags(file, tags, 3)
+	assert.NoError(t, err, "Expected no error writing the tags.")
+
+	metadata, err := model.NewMiner().ReadTags(file)
+	assert.NoError(t, err, "Expected no error reading the written tags.")
+	assert.Equal(t, "ID3v2.4", string(metadata.TagFormat), "Expected the version of the tag to be kept.")
+	assert.Equal(t, "New Title", metadata.Title, "Expected the title to be written.")
+	assert.Equal(t, "New Artist", metadata.Artist, "Expected the artist to be written.")
+	assert.Equal(t, "New Album", metadata.Album, "Expected the album to be written.")
+	assert.Equal(t, 2001, metadata.Year, "Expected the year to be written.")
+	assert.Equal(t, 3, metadata.Track, "Expected the track to be written.")
+	assert.Equal(t, 24, metadata.TrackTotal, "Expected the track total to be kept.")
+	assert.Empty(t, metadata.Genre, "Expected the empty genre to be removed.")
+	assert.Equal(t, "Test Compositor", metadata.Composer, "Expected the other frames to be kept.")
+	assert.Equal(t, 5, metadata.Disc, "Expected the other frames to be kept.")
+
+	entries, err := os.ReadDir(tempDir)
+	assert.NoError(t, err, "Expected no error listing the directory.")
+	assert.Len(t, entries, 1, "Expected no temporary file left behind.")
+}
+
+func TestWriteID3TagsWithoutTag(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "untagged.mp3")
+	audio := append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 413)...)
+	err := os.WriteFile(file, audio, 0644)
+	assert.NoError(t, err, "Failed to create the mp3 file.")
+
+	err = model.WriteID3Tags(file, model.ID3Tags{Title: "Canción", Genre: "Rock", Year: 1999}, 3)
+	assert.NoError(t, err, "Expected no error writing the tags.")
+
+	metadata, err := model.NewMiner().ReadTags(file)
+	assert.NoError(t, err, "Expected no error reading the written tags.")
+	assert.Equal(t, "ID3v2.3", string(metadata.TagFormat), "Expected a tag of the given version.")
+	assert.Equal(t, "Canción", metadata.Title, "Expected the title to be written in UTF-16.")
+	assert.Equal(t, "Rock", metadata.Genre, "Expected the genre to be written.")
+	assert.Equal(t, 1999, metadata.Year, "Expected the year to be written.")
+
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err, "Expected no error reading the file.")
+	assert.Equal(t, audio, content[len(content)-len(audio):], "Expected the audio to be kept.")
+
+	err = model.WriteID3Tags(file, model.ID3Tags{}, 2)
+	assert.Error(t, err, "Expected an error for an unsupported version.")
+}
+
+func TestControllerWriteTags(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3", "test2.mp3"})
+	_, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 2, "Expected both files to be inserted.")
+	song := songs[0]
+
+	err = c.EditSong(song.ID, "Edited", "Jazz", 7, 2010)
+	assert.NoError(t, err, "Expected no error editing the song.")
+	err = c.WriteSongTags(song.ID)
+	assert.NoError(t, err, "Expected no error writing the song tags.")
+
+	metadata, err := c.Miner.ReadTags(song.Path)
+	assert.NoError(t, err, "Expected no error reading the written tags.")
+	assert.Equal(t, "Edited", metadata.Title, "Expected the edited title to be written.")
+	assert.Equal(t, "Jazz", metadata.Genre, "Expected the edited genre to be written.")
+	assert.Equal(t, 7, metadata.Track, "Expected the edited track to be written.")
+	assert.Equal(t, 2010, metadata.Year, "Expected the edited year to be written.")
+
+	states, err := c.DB.GetFileStates()
+	assert.NoError(t, err, "Expected no error getting the file states.")
+	info, err := os.Stat(song.Path)
+	assert.NoError(t, err, "Expected no error reading the file info.")
+	assert.True(t, states[song.Path].Matches(info), "Expected the file state to follow the written file.")
+
+	err = c.EditAlbum(song.AlbumID, "Edited Album", 2011)
+	assert.NoError(t, err, "Expected no error editing the album.")
+	written, err := c.SyncTagsToFiles(context.Background(), func(int) {})
+	assert.NoError(t, err, "Expected no error syncing the tags.")
+	assert.Equal(t, 2, written, "Expected every file to be written.")
+	for _, song := range songs {
+		metadata, err := c.Miner.ReadTags(song.Path)
+		assert.NoError(t, err, "Expected no error reading the written tags.")
+		assert.Equal(t, "Edited Album", metadata.Album, "Expected the edited album to be written.")
+	}
+
+	_, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata again.")
+	song, err = c.DB.GetSong(song.ID)
+	assert.NoError(t, err, "Expected no error getting the song.")
+	assert.Equal(t, "Edited", song.Title, "Expected the edit to survive mining again.")
+}
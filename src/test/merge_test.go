@@ -0,0 +1,140 @@
+package test
+
+import (
+	"testing"
+	"github.com/KevinJGard/MusicDB/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func insertMergeSong(t *testing.T, db *model.DataBase, performerID, albumID int64, path string) int64 {
+	err := db.InsertSong(&model.Song{PerformerID: performerID, AlbumID: albumID, Path: path, Title: path, Year: 1969})
+	assert.NoError(t, err, "Failed inserting song.")
+	songID, err := db.GetSongIDByPath(path)
+	assert.NoError(t, err, "Failed getting song ID.")
+	return songID
+}
+
+func TestNormalizeName(t *testing.T) {
+	assert.Equal(t, "beatles", model.NormalizeName("The Beatles"), "Expected a leading 'The' to be dropped.")
+	assert.Equal(t, "beatles", model.NormalizeName(" the beatles! "), "Expected case and punctuation to be dropped.")
+	assert.Equal(t, "simonandgarfunkel", model.NormalizeName("Simon & Garfunkel"), "Expected '&' to read as 'and'.")
+	assert.Equal(t, "theband", model.NormalizeName("Theband"), "Expected only a leading 'The' word to be dropped.")
+	assert.Empty(t, model.NormalizeName("?!"), "Expected no key for a name without letters.")
+}
+
+func TestFindDuplicates(t *testing.T) {
+	c := setupMiningController(t, nil)
+	db := c.DB
+	beatlesID, err := db.InsertPerformerIfNotExists("Beatles", 2)
+	assert.NoError(t, err, "Failed inserting performer.")
+	theBeatlesID, err := db.InsertPerformerIfNotExists("The Beatles", 2)
+	assert.NoError(t, err, "Failed inserting performer.")
+	_, err = db.InsertPerformerIfNotExists("Stones", 2)
+	assert.NoError(t, err, "Failed inserting performer.")
+	abbeyID, err := db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "Abbey Road", 1969, theBeatlesID, "/music/a/1.mp3")
+	assert.NoError(t, err, "Failed inserting album.")
+	otherAbbeyID, err := db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "abbey road", 1969, beatlesID, "/music/b/1.mp3")
+	assert.NoError(t, err, "Failed inserting album.")
+	_, err = db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "Abbey Road", 2019, 0, "/music/c/1.mp3")
+	assert.NoError(t, err, "Failed inserting album.")
+	insertMergeSong(t, db, theBeatlesID, abbeyID, "/music/a/1.mp3")
+	insertMergeSong(t, db, theBeatlesID, abbeyID, "/music/a/2.mp3")
+
+	performers, err := c.FindDuplicatePerformers()
+	assert.NoError(t, err, "Expected no error finding duplicate performers.")
+	assert.Len(t, performers, 1, "Expected one group of duplicate performers.")
+	assert.Equal(t, "beatles", performers[0].Key, "Expected the normalized name as the key.")
+	assert.Equal(t, []model.MergeCandidate{
+		{ID: theBeatlesID, Name: "The Beatles", Songs: 2},
+		{ID: beatlesID, Name: "Beatles"},
+	}, performers[0].Candidates, "Expected the performer with most songs first.")
+
+	albums, err := c.FindDuplicateAlbums()
+	assert.NoError(t, err, "Expected no error finding duplicate albums.")
+	assert.Len(t, albums, 1, "Expected albums without the same album artist not to be duplicates.")
+	assert.Equal(t, []model.MergeCandidate{
+		{ID: abbeyID, Name: "Abbey Road", Detail: "/music/a", Songs: 2},
+		{ID: otherAbbeyID, Name: "abbey road", Detail: "/music/b"},
+	}, albums[0].Candidates, "Expected the albums by duplicate artists to be duplicates.")
+}
+
+func TestMergePerformers(t *testing.T) {
+	c := setupMiningController(t, nil)
+	db := c.DB
+	keepID, err := db.InsertPerformerIfNotExists("The Beatles", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+	duplicateID, err := db.InsertPerformerIfNotExists("Beatles", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+	err = c.DefGroup(duplicateID, "Beatles", "1960", "1970")
+	assert.NoError(t, err, "Failed defining the group.")
+	albumID, err := db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "Abbey Road", 1969, duplicateID, "/music/a/1.mp3")
+	assert.NoError(t, err, "Failed inserting album.")
+	songID := insertMergeSong(t, db, duplicateID, albumID, "/music/a/1.mp3")
+	otherID := insertMergeSong(t, db, keepID, albumID, "/music/a/2.mp3")
+	err = db.SetCredits(songID, model.RoleComposer, []int64{duplicateID})
+	assert.NoError(t, err, "Failed crediting the composer.")
+	err = db.SetCredits(otherID, model.RoleComposer, []int64{keepID, duplicateID})
+	assert.NoError(t, err, "Failed crediting the composers.")
+
+	err = c.MergePerformers(keepID, nil)
+	assert.Error(t, err, "Expected an error merging nothing.")
+	err = c.MergePerformers(keepID, []int64{duplicateID, 999})
+	assert.Error(t, err, "Expected an error merging a performer that does not exist.")
+	err = c.MergePerformers(keepID, []int64{keepID})
+	assert.Error(t, err, "Expected an error merging a performer into itself.")
+	performer, err := db.GetPerformer(duplicateID)
+	assert.NoError(t, err, "Expected a failed merge to change nothing.")
+	assert.Equal(t, "Beatles", performer.Name, "Expected a failed merge to change nothing.")
+
+	err = c.MergePerformers(keepID, []int64{duplicateID})
+	assert.NoError(t, err, "Expected no error merging the performers.")
+	_, err = db.GetPerformer(duplicateID)
+	assert.Error(t, err, "Expected the duplicate to be deleted.")
+	song, err := db.GetSong(songID)
+	assert.NoError(t, err, "Expected no error getting the song.")
+	assert.Equal(t, keepID, song.PerformerID, "Expected the song to be moved to the survivor.")
+	assert.Equal(t, keepID, song.AlbumArtistID, "Expected the album to be moved to the survivor.")
+	composers, err := db.GetCredits(otherID, model.RoleComposer)
+	assert.NoError(t, err, "Expected no error getting the credits.")
+	assert.Equal(t, []model.Performer{{ID: keepID, Type: 1, Name: "The Beatles"}}, composers,
+		"Expected the credits to be moved to the survivor once.")
+	composers, err = db.GetCredits(songID, model.RoleComposer)
+	assert.NoError(t, err, "Expected no error getting the credits.")
+	assert.Len(t, composers, 1, "Expected the credits to be moved to the survivor.")
+	group, ok, err := db.GetGroupByPerformer(keepID)
+	assert.NoError(t, err, "Expected no error getting the group.")
+	assert.True(t, ok, "Expected the survivor to take the duplicate's group.")
+	assert.Equal(t, "1960", group.StartDate, "Expected the survivor to take the duplicate's group.")
+
+	songs, err := c.GetSearchSongs(`ar:"The Beatles"`, model.SearchOptions{})
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Len(t, songs, 2, "Expected the merged songs to be found by the survivor's name.")
+}
+
+func TestMergeAlbums(t *testing.T) {
+	c := setupMiningController(t, nil)
+	db := c.DB
+	performerID, err := db.InsertPerformerIfNotExists("The Beatles", 0)
+	assert.NoError(t, err, "Failed inserting performer.")
+	keepID, err := db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "Abbey Road", 0, 0, "/music/a/1.mp3")
+	assert.NoError(t, err, "Failed inserting album.")
+	duplicateID, err := db.GetOrInsertAlbum(model.AlbumByArtistAndDirectory, "abbey road", 1969, performerID, "/music/b/1.mp3")
+	assert.NoError(t, err, "Failed inserting album.")
+	err = db.SetAlbumCover(duplicateID, "cafe")
+	assert.NoError(t, err, "Failed setting the cover.")
+	songID := insertMergeSong(t, db, performerID, duplicateID, "/music/b/1.mp3")
+	insertMergeSong(t, db, performerID, keepID, "/music/a/1.mp3")
+
+	err = c.MergeAlbums(keepID, []int64{duplicateID})
+	assert.NoError(t, err, "Expected no error merging the albums.")
+	song, err := db.GetSong(songID)
+	assert.NoError(t, err, "Expected no error getting the song.")
+	assert.Equal(t, keepID, song.AlbumID, "Expected the song to be moved to the survivor.")
+	assert.Equal(t, "Abbey Road", song.AlbumName, "Expected the survivor's name to be kept.")
+	assert.Equal(t, 1969, song.AlbumYear, "Expected the survivor to take the missing year.")
+	assert.Equal(t, performerID, song.AlbumArtistID, "Expected the survivor to take the missing album artist.")
+	assert.Equal(t, "cafe", song.AlbumCover, "Expected the survivor to take the missing cover.")
+	albums, err := c.FindDuplicateAlbums()
+	assert.NoError(t, err, "Expected no error finding duplicate albums.")
+	assert.Empty(t, albums, "Expected the duplicate album to be deleted.")
+}
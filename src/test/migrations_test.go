@@ -0,0 +1,171 @@
+package test
+
+import (
+	"testing"
+	"path/filepath"
+	"strconv"
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/KevinJGard/MusicDB/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateNewDataBase(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Db.Close()
+
+	version, err := db.GetSchemaVersion()
+	assert.NoError(t, err, "Expected no error reading schema version.")
+	assert.Equal(t, model.SchemaVersion(), version, "Expected database to be at the latest schema version.")
+}
+
+func TestMigrateUnversionedDataBase(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "music.db")
+	old, err := sql.Open("sqlite3", dbFile)
+	assert.NoError(t, err, "Failed opening raw database.")
+	_, err = old.Exec(`CREATE TABLE albums (id_album INTEGER PRIMARY KEY, path TEXT, name TEXT, year INTEGER);`)
+	assert.NoError(t, err, "Failed creating legacy table.")
+	_, err = old.Exec(`INSERT INTO albums (path, name, year) VALUES ('/path/test', 'Old Album', 1999);`)
+	assert.NoError(t, err, "Failed inserting legacy album.")
+	old.Close()
+
+	db, err := model.OpenDataBase(dbFile)
+	assert.NoError(t, err, "Expected legacy database to be migrated.")
+	defer db.Db.Close()
+
+	id, err := db.GetAlbumID("Old Album", 1999)
+	assert.NoError(t, err, "Expected no error while getting album ID.")
+	assert.Equal(t, int64(1), id, "Expected legacy data to survive the migration.")
+	assertTableExists(t, db, "rolas")
+}
+
+func TestRefuseNewerSchema(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "music.db")
+	newer, err := sql.Open("sqlite3", dbFile)
+	assert.NoError(t, err, "Failed opening raw database.")
+	_, err = newer.Exec(`PRAGMA user_version = 9999`)
+	assert.NoError(t, err, "Failed setting schema version.")
+	newer.Close()
+
+	db, err := model.OpenDataBase(dbFile)
+	assert.Error(t, err, "Expected an error opening a database newer than the binary.")
+	assert.Nil(t, db, "Expected no database to be returned.")
+}
+
+// placeholdersVersion is the schema version that cleared the placeholders. The test goes back
+// to the version before it, undoing the later migrations.
+const placeholdersVersion = 7
+
+func TestMigrateClearsPlaceholders(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "music.db")
+	db, err := model.OpenDataBase(dbFile)
+	assert.NoError(t, err, "Failed opening database.")
+	for _, query := range []string{
+		`INSERT INTO performers (id_performer, id_type, name) VALUES (1, 2, 'Unknown')`,
+		`INSERT INTO albums (id_album, path, name, year) VALUES (1, '/music', 'Unknown', 2024)`,
+		`INSERT INTO rolas (id_performer, id_album, path, title, track, year, genre, size, mtime)
+			VALUES (1, 1, '/music/a.mp3', 'Unknown', 1, 2024, 'Unknown', 10, 10)`,
+		`ALTER TABLE rolas DROP COLUMN cover`,
+		`ALTER TABLE albums DROP COLUMN cover`,
+		`ALTER TABLE rolas DROP COLUMN duration_ms`,
+		`ALTER TABLE rolas DROP COLUMN bitrate`,
+		`ALTER TABLE rolas DROP COLUMN sample_rate`,
+		`ALTER TABLE rolas DROP COLUMN channels`,
+		`ALTER TABLE rolas DROP COLUMN vbr`,
+		`ALTER TABLE rolas DROP COLUMN encoder`,
+		`ALTER TABLE performers DROP COLUMN id_person`,
+		`ALTER TABLE performers DROP COLUMN id_group`,
+		`ALTER TABLE in_group DROP COLUMN start_date`,
+		`ALTER TABLE in_group DROP COLUMN end_date`,
+		`ALTER TABLE in_group DROP COLUMN role`,
+		`PRAGMA user_version = ` + strconv.Itoa(placeholdersVersion-1),
+	} {
+		_, err = db.Db.Exec(query)
+		assert.NoError(t, err, "Failed preparing placeholders.")
+	}
+	db.Db.Close()
+
+	db, err = model.OpenDataBase(dbFile)
+	assert.NoError(t, err, "Expected the placeholders to be migrated.")
+	defer db.Db.Close()
+	song, err := db.GetSong(1)
+	assert.NoError(t, err, "Expected no error getting the song.")
+	assert.Empty(t, song.Title, "Expected the placeholder title to be cleared.")
+	assert.Empty(t, song.Genre, "Expected the placeholder genre to be cleared.")
+	assert.Zero(t, song.PerformerID, "Expected the placeholder performer to be unlinked.")
+	assert.Zero(t, song.AlbumID, "Expected the placeholder album to be unlinked.")
+	state, _, err := db.GetFileState("/music/a.mp3")
+	assert.NoError(t, err, "Expected no error getting the file state.")
+	assert.Equal(t, int64(-1), state.Size, "Expected the file to be mined again.")
+	id, err := db.GetPerformerID("Unknown")
+	assert.NoError(t, err, "Expected no error getting performer.")
+	assert.Zero(t, id, "Expected the placeholder performer to be deleted.")
+}
+
+// performerDetailsVersion is the schema version that linked the performers to their details.
+const performerDetailsVersion = 11
+
+func TestMigrateLinksPerformerDetails(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "music.db")
+	db, err := model.OpenDataBase(dbFile)
+	assert.NoError(t, err, "Failed opening database.")
+	for _, query := range []string{
+		`ALTER TABLE performers DROP COLUMN id_person`,
+		`ALTER TABLE performers DROP COLUMN id_group`,
+		`ALTER TABLE in_group DROP COLUMN start_date`,
+		`ALTER TABLE in_group DROP COLUMN end_date`,
+		`ALTER TABLE in_group DROP COLUMN role`,
+		`INSERT INTO performers (id_performer, id_type, name) VALUES (1, 0, 'Singer'), (2, 1, 'Band'), (3, 2, 'Other')`,
+		`INSERT INTO persons (id_person, stage_name, real_name, birth_date, death_date) VALUES (7, 'Singer', 'Real', '1960', '0')`,
+		`INSERT INTO groups (id_group, name, start_date, end_date) VALUES (8, 'Band', '1980', '0')`,
+		`PRAGMA user_version = ` + strconv.Itoa(performerDetailsVersion-1),
+	} {
+		_, err = db.Db.Exec(query)
+		assert.NoError(t, err, "Failed preparing performers.")
+	}
+	db.Db.Close()
+
+	db, err = model.OpenDataBase(dbFile)
+	assert.NoError(t, err, "Expected the performers to be migrated.")
+	defer db.Db.Close()
+	person, ok, err := db.GetPersonByPerformer(1)
+	assert.NoError(t, err, "Expected no error getting the person.")
+	assert.True(t, ok, "Expected the person to be linked by stage name.")
+	assert.Equal(t, int64(7), person.ID, "Expected the person with the performer's name.")
+	group, ok, err := db.GetGroupByPerformer(2)
+	assert.NoError(t, err, "Expected no error getting the group.")
+	assert.True(t, ok, "Expected the group to be linked by name.")
+	assert.Equal(t, int64(8), group.ID, "Expected the group with the performer's name.")
+	_, ok, err = db.GetPersonByPerformer(3)
+	assert.NoError(t, err, "Expected no error getting the person.")
+	assert.False(t, ok, "Expected an undefined performer not to be linked.")
+}
+
+// artistCreditsVersion is the schema version right after the artists of songs are credited.
+const artistCreditsVersion = 13
+
+func TestMigrateCreditsArtists(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "music.db")
+	db, err := model.OpenDataBase(dbFile)
+	assert.NoError(t, err, "Failed opening database.")
+	for _, query := range []string{
+		`INSERT INTO performers (id_performer, id_type, name) VALUES (1, 2, 'A & B')`,
+		`INSERT INTO rolas (id_rola, id_performer, path, title, size, mtime) VALUES (1, 1, '/a.mp3', 'A', 10, 10), (2, NULL, '/b.mp3', 'B', 10, 10)`,
+		`PRAGMA user_version = ` + strconv.Itoa(artistCreditsVersion-1),
+	} {
+		_, err = db.Db.Exec(query)
+		assert.NoError(t, err, "Failed preparing songs.")
+	}
+	db.Db.Close()
+
+	db, err = model.OpenDataBase(dbFile)
+	assert.NoError(t, err, "Expected the songs to be migrated.")
+	defer db.Db.Close()
+	artists, err := db.GetCredits(1, model.RoleArtist)
+	assert.NoError(t, err, "Expected no error getting the credits.")
+	assert.Equal(t, []model.Performer{{ID: 1, Type: 2, Name: "A & B"}}, artists, "Expected the performer to be credited as artist.")
+	states, err := db.GetFileStates()
+	assert.NoError(t, err, "Expected no error getting the file states.")
+	assert.Equal(t, int64(-1), states["/a.mp3"].Size, "Expected the song with an artist to be mined again.")
+	assert.Equal(t, int64(10), states["/b.mp3"].Size, "Expected the song without an artist to be kept.")
+}
@@ -2,9 +2,13 @@ package test
 
 import (
 	"testing"
+	"bytes"
+	"context"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
+	"github.com/KevinJGard/MusicDB/src/controller"
 	"github.com/KevinJGard/MusicDB/src/model"
 	"github.com/dhowden/tag"
 	"github.com/stretchr/testify/assert"
@@ -54,6 +58,59 @@ func TestFindMP3Files(t *testing.T) {
 	}
 }
 
+func TestFindAudioFiles(t *testing.T) {
+	files := []string{"test1.mp3", "test2.MP3", "test3.Flac", "test4.ogg", "test5.opus", "test6.m4a", "test7.txt"}
+	tempDir := t.TempDir()
+	err := createTempDirectoryWithFiles(tempDir, files)
+	assert.NoError(t, err, "Failed to create temp dir with files.")
+
+	foundFiles, err := model.NewMiner().FindAudioFiles(tempDir)
+	assert.NoError(t, err, "Error traversing directory %s.", tempDir)
+	assert.Len(t, foundFiles, 6, "Expected every audio extension to be found, in any case.")
+	assert.NotContains(t, foundFiles, filepath.Join(tempDir, "test7.txt"), "Expected other files to be ignored.")
+}
+
+func TestDetectFormat(t *testing.T) {
+	oggPage := func(codec string) []byte {
+		header := append([]byte("OggS"), make([]byte, 24)...)
+		return append(header, codec...)
+	}
+	contents := map[string][]byte{
+		"flac.mp3":   []byte("fLaC\x00\x00\x00\x22"),
+		"vorbis.ogg": oggPage("\x01vorbis"),
+		"opus.ogg":   oggPage("OpusHead"),
+		"m4a.mp3":    []byte("\x00\x00\x00\x20ftypM4A "),
+		"mp3.flac":   []byte("ID3\x04\x00"),
+		"noise.opus": []byte("noise"),
+	}
+	expected := map[string]string{
+		"flac.mp3": "flac", "vorbis.ogg": "vorbis", "opus.ogg": "opus",
+		"m4a.mp3": "m4a", "mp3.flac": "mp3", "noise.opus": "opus",
+	}
+
+	miner := model.NewMiner()
+	for name, content := range contents {
+		format, err := miner.DetectFormat(name, bytes.NewReader(content))
+		assert.NoError(t, err, "Expected no error detecting the format of %s.", name)
+		assert.Equal(t, expected[name], format, "Unexpected format for %s.", name)
+	}
+}
+
+func TestSearchByFormat(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3", "test2.Mp3"})
+	_, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+
+	songs, err := c.GetSearchSongs("fo:MP3", model.SearchOptions{})
+	assert.NoError(t, err, "Expected no error searching by format.")
+	assert.Len(t, songs, 2, "Expected every mined file to be an MP3.")
+	assert.Equal(t, "mp3", songs[0].Format, "Expected the format to be stored.")
+
+	songs, err = c.GetSearchSongs("fo:flac", model.SearchOptions{})
+	assert.NoError(t, err, "Expected no error searching by format.")
+	assert.Empty(t, songs, "Expected no FLAC files.")
+}
+
 func TestMineMetadata(t *testing.T) {
 	files := []string{"test1.mp3", "test2.mp3", "test3.mp3"}
 	tempDir := t.TempDir()
@@ -67,14 +124,15 @@ func TestMineMetadata(t *testing.T) {
 		metadata, err := miner.MineMetadata(filePath)
 		assert.NoError(t, err, "Error reading metadata for %s.", file)
 		
-		assert.NotEmpty(t, metadata["Title"], "Tag \"Title\" not found in %s.", filePath)
-		assert.NotEmpty(t, metadata["Artist"], "Tag \"Artist\" not found in %s.", filePath)
-		assert.NotEmpty(t, metadata["Album"], "Tag \"Album\" not found in %s.", filePath)
-		assert.NotEmpty(t, metadata["Genre"], "Tag \"Genre\" not found in %s.", filePath)
-		assert.NotZero(t, metadata["Year"], "Tag \"Year\" not found in %s.", filePath)
-		track := metadata["Track"].(map[string]int)
-		assert.NotZero(t, track["Number"], "Tag \"Track\" number not found in %s.", filePath)
-		assert.NotZero(t, track["Total"], "Tag \"Track\" total not found in %s.", filePath)
+		assert.NotEmpty(t, metadata.Title, "Tag \"Title\" not found in %s.", filePath)
+		assert.NotEmpty(t, metadata.Artist, "Tag \"Artist\" not found in %s.", filePath)
+		assert.NotEmpty(t, metadata.Album, "Tag \"Album\" not found in %s.", filePath)
+		assert.NotEmpty(t, metadata.Genre, "Tag \"Genre\" not found in %s.", filePath)
+		assert.NotZero(t, metadata.Year, "Tag \"Year\" not found in %s.", filePath)
+		assert.NotZero(t, metadata.Track, "Tag \"Track\" number not found in %s.", filePath)
+		assert.NotZero(t, metadata.TrackTotal, "Tag \"Track\" total not found in %s.", filePath)
+		assert.Equal(t, "ID3v2.4", metadata.TagFormat, "Expected the tag format of %s.", filePath)
+		assert.Equal(t, "mp3", metadata.Format, "Expected the audio format of %s.", filePath)
 	}
 }
 
@@ -88,14 +146,14 @@ func TestAssignTag(t *testing.T) {
 
 	miner := model.NewMiner()
 	tags := miner.AssignTag(metadata)
-	assert.NotEmpty(t, tags["Title"], "Expected a valid Title or \"Unknown\".")
-	assert.NotEmpty(t, tags["Artist"], "Expected a valid Artist or \"Unknown\".")
-	assert.NotEmpty(t, tags["Album"], "Expected a valid Album or \"Unknown\".")
-	assert.NotEmpty(t, tags["Title"], "Expected a valid Title or \"Unknown\".")
-	assert.NotZero(t, tags["Year"], "Expected a valid Year or \"1\".")
-	track := tags["Track"].(map[string]int)
-	assert.NotZero(t, track["Number"], "Expected valid Track number or \"1\".")
-	assert.NotZero(t, track["Total"], "Expected valid Track total or \"1\".")
+	assert.Empty(t, tags.Title, "Expected a missing Title to stay empty.")
+	assert.Empty(t, tags.Artist, "Expected a missing Artist to stay empty.")
+	assert.Empty(t, tags.Album, "Expected a missing Album to stay empty.")
+	assert.Empty(t, tags.Genre, "Expected a missing Genre to stay empty.")
+	assert.Zero(t, tags.Year, "Expected a missing Year to stay zero.")
+	assert.Zero(t, tags.Track, "Expected a missing Track number to stay zero.")
+	assert.Zero(t, tags.TrackTotal, "Expected a missing Track total to stay zero.")
+	assert.Equal(t, 1, tags.Disc, "Expected a missing Disc number to be the first disc.")
 }
 
 func TestProcessFile(t *testing.T) {
@@ -128,4 +186,481 @@ func TestProcessFile(t *testing.T) {
 	assert.NotZero(t, id, "Expected album to be inserted into the database.")
 
 	defer db.Db.Close()
-}
\ No newline at end of file
+}
+
+func setupMiningController(t *testing.T, files []string) *controller.Controller {
+	os.Setenv("HOME", t.TempDir())
+	c := controller.NewController()
+	t.Cleanup(func() { c.DB.Db.Close() })
+
+	musicDir := t.TempDir()
+	err := createTempDirectoryWithFiles(musicDir, files)
+	assert.NoError(t, err, "Failed to create temp dir with files.")
+	err = c.SetMusicDirectory(musicDir)
+	assert.NoError(t, err, "Failed to set music directory.")
+	c.Config.Workers = 3
+	return c
+}
+
+func TestControllerMineMetadata(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3", "test2.mp3", "test3.mp3", "test4.mp3", "test5.mp3"})
+
+	lastProgress := 0
+	completed := false
+	_, err := c.MineMetadata(context.Background(), func(progress int) { lastProgress = progress }, func() { completed = true })
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	assert.True(t, completed, "Expected mining to complete.")
+	assert.Equal(t, 100, lastProgress, "Expected progress to reach 100%.")
+
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 5, "Expected every file to be inserted once.")
+}
+
+func TestControllerMineMetadataReport(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3", "test2.mp3"})
+	broken := filepath.Join(c.Config.MusicDirectory, "broken.mp3")
+	err := os.WriteFile(broken, []byte("ID3\x04\x00\x00\x00\x00\x7f\x7fabc"), 0644)
+	assert.NoError(t, err, "Failed to write the broken file.")
+
+	lastProgress := 0
+	report, err := c.MineMetadata(context.Background(), func(progress int) { lastProgress = progress }, func() {})
+	assert.NoError(t, err, "Expected a failed file not to stop the mining.")
+	assert.Equal(t, 100, lastProgress, "Expected progress to reach 100% despite the failure.")
+	assert.Equal(t, 3, report.Scanned, "Expected every file to be scanned.")
+	assert.Equal(t, 2, report.Added, "Expected the good files to be added.")
+	assert.Equal(t, 1, report.Failed, "Expected the broken file to fail.")
+	assert.Len(t, report.Failures, 1, "Expected the failure to be listed.")
+	assert.Equal(t, broken, report.Failures[0].File, "Expected the failed file to be named.")
+	assert.NotEmpty(t, report.Failures[0].Reason, "Expected the reason of the failure.")
+	assert.Positive(t, report.Elapsed, "Expected the elapsed time to be measured.")
+
+	err = os.Rename(filepath.Join(c.Config.MusicDirectory, "test2.mp3"), filepath.Join(c.Config.MusicDirectory, "moved.mp3"))
+	assert.NoError(t, err, "Failed to move the file.")
+	report, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata again.")
+	assert.Equal(t, 1, report.Skipped, "Expected the unchanged file to be skipped.")
+	assert.Equal(t, 1, report.Moved, "Expected the moved file to be recognized.")
+	assert.Equal(t, 1, report.Failed, "Expected the broken file to fail again.")
+
+	last, ok, err := c.LastScanReport()
+	assert.NoError(t, err, "Expected no error reading the last scan report.")
+	assert.True(t, ok, "Expected the report to be saved.")
+	assert.Equal(t, report.Moved, last.Moved, "Expected the last report to be saved.")
+	assert.Equal(t, report.Failures, last.Failures, "Expected the failures to be saved.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.MineMetadata(ctx, func(int) {}, func() {})
+	assert.ErrorIs(t, err, context.Canceled, "Expected mining to stop when cancelled.")
+	last, _, err = c.LastScanReport()
+	assert.NoError(t, err, "Expected no error reading the last scan report.")
+	assert.True(t, last.Cancelled, "Expected the cancelled mining to be reported.")
+}
+
+func TestControllerMineMetadataCancelled(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3", "test2.mp3", "test3.mp3"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	completed := false
+	_, err := c.MineMetadata(ctx, func(int) {}, func() { completed = true })
+	assert.ErrorIs(t, err, context.Canceled, "Expected mining to stop when cancelled.")
+	assert.False(t, completed, "Expected a cancelled mining not to complete.")
+}
+
+func TestControllerMineMetadataIncremental(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3", "test2.mp3"})
+	mine := func() {
+		_, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+		assert.NoError(t, err, "Expected no error mining metadata.")
+	}
+	mine()
+
+	file := filepath.Join(c.Config.MusicDirectory, "test1.mp3")
+	id, err := c.DB.GetSongIDByPath(file)
+	assert.NoError(t, err, "Expected no error getting song by path.")
+	assert.NotZero(t, id, "Expected the file to be mined.")
+	err = c.DB.UpdateSong(id, "Edited", "Jazz", 7, 2001)
+	assert.NoError(t, err, "Expected no error editing song.")
+
+	mine()
+	song, err := c.DB.GetSong(id)
+	assert.NoError(t, err, "Expected no error getting song.")
+	assert.Equal(t, "Edited", song.Title, "Expected unchanged files to be skipped.")
+
+	later := time.Now().Add(time.Hour)
+	err = os.Chtimes(file, later, later)
+	assert.NoError(t, err, "Failed changing modification time.")
+	mine()
+	song, err = c.DB.GetSong(id)
+	assert.NoError(t, err, "Expected no error getting song.")
+	assert.Equal(t, "Test Title", song.Title, "Expected modified files to update their song.")
+
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 2, "Expected modified files not to be inserted again.")
+}
+
+func TestControllerMineMetadataFollowsMovedFiles(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3"})
+	mine := func() {
+		_, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+		assert.NoError(t, err, "Expected no error mining metadata.")
+	}
+	mine()
+
+	oldPath := filepath.Join(c.Config.MusicDirectory, "test1.mp3")
+	id, err := c.DB.GetSongIDByPath(oldPath)
+	assert.NoError(t, err, "Expected no error getting song by path.")
+	err = c.DB.UpdateSong(id, "Edited", "Jazz", 7, 2001)
+	assert.NoError(t, err, "Expected no error editing song.")
+
+	err = os.MkdirAll(filepath.Join(c.Config.MusicDirectory, "moved"), os.ModePerm)
+	assert.NoError(t, err, "Failed creating directory.")
+	newPath := filepath.Join(c.Config.MusicDirectory, "moved", "renamed.mp3")
+	err = os.Rename(oldPath, newPath)
+	assert.NoError(t, err, "Failed moving file.")
+	mine()
+
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 1, "Expected a moved file not to create a new song.")
+	assert.Equal(t, id, songs[0].ID, "Expected the song to follow its file.")
+	assert.Equal(t, newPath, songs[0].Path, "Expected the song path to be updated.")
+	assert.Equal(t, "Edited", songs[0].Title, "Expected edits to survive the move.")
+	assert.False(t, songs[0].Missing, "Expected a moved song not to be missing.")
+}
+
+func TestControllerMineMetadataMissingFiles(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3", "test2.mp3"})
+	mine := func() {
+		_, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+		assert.NoError(t, err, "Expected no error mining metadata.")
+	}
+	mine()
+
+	removed := filepath.Join(c.Config.MusicDirectory, "test2.mp3")
+	err := os.Remove(removed)
+	assert.NoError(t, err, "Failed removing file.")
+	mine()
+
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 2, "Expected missing songs to be kept by default.")
+	for _, song := range songs {
+		assert.Equal(t, song.Path == removed, song.Missing, "Expected only the removed file to be missing.")
+	}
+
+	err = copyMp3(c.Config.MusicDirectory, "test2.mp3")
+	assert.NoError(t, err, "Failed restoring file.")
+	mine()
+	songs, err = c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 2, "Expected a restored file to reuse its song.")
+	for _, song := range songs {
+		assert.False(t, song.Missing, "Expected restored files not to be missing.")
+	}
+
+	err = os.Remove(removed)
+	assert.NoError(t, err, "Failed removing file.")
+	err = os.Remove(filepath.Join(c.Config.MusicDirectory, "test1.mp3"))
+	assert.NoError(t, err, "Failed removing file.")
+	c.Config.PruneMissing = true
+	c.Config.PruneOrphans = true
+	mine()
+
+	songs, err = c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Empty(t, songs, "Expected missing songs to be pruned.")
+	performerID, err := c.DB.GetPerformerID("Test Artist")
+	assert.NoError(t, err, "Expected no error getting performer.")
+	assert.Zero(t, performerID, "Expected orphaned performers to be pruned.")
+	performerID, err = c.DB.GetPerformerID("Test Compositor")
+	assert.NoError(t, err, "Expected no error getting composer.")
+	assert.Zero(t, performerID, "Expected composers of pruned songs to be pruned.")
+	var albums int
+	err = c.DB.Db.QueryRow(`SELECT count(*) FROM albums`).Scan(&albums)
+	assert.NoError(t, err, "Expected no error counting albums.")
+	assert.Zero(t, albums, "Expected orphaned albums to be pruned.")
+}
+
+func TestStoreMetadataKeepsAlbumArtist(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Db.Close()
+	miner := model.NewMiner()
+	miner.AlbumIdentity = model.AlbumByDirectory
+	dir := t.TempDir()
+	store := func(name, albumArtist string) model.Song {
+		file := filepath.Join(dir, name)
+		err := os.WriteFile(file, []byte(name), 0644)
+		assert.NoError(t, err, "Failed writing the file.")
+		info, err := os.Stat(file)
+		assert.NoError(t, err, "Failed reading the file.")
+		metadata := model.TrackMetadata{Title: name, Album: "Mix", AlbumArtist: albumArtist}
+		_, _, err = miner.StoreMetadata(db, file, info, name, metadata)
+		assert.NoError(t, err, "Expected no error storing the metadata.")
+		songID, err := db.GetSongIDByPath(file)
+		assert.NoError(t, err, "Expected no error getting the song ID.")
+		song, err := db.GetSong(songID)
+		assert.NoError(t, err, "Expected no error getting the song.")
+		return song
+	}
+
+	assert.Empty(t, store("a.mp3", "").AlbumArtistName, "Expected no album artist yet.")
+	assert.Equal(t, "First", store("b.mp3", "First").AlbumArtistName, "Expected an album without artist to take one.")
+	assert.Equal(t, "First", store("c.mp3", "Second").AlbumArtistName, "Expected the album artist not to be overwritten.")
+	assert.Equal(t, "First", store("b.mp3", "First").AlbumArtistName, "Expected the same album to be kept.")
+}
+
+func TestControllerWatch(t *testing.T) {
+	c := setupMiningController(t, nil)
+	c.Config.WatchDelay = 100
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changed := make(chan struct{}, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Watch(ctx, func() { changed <- struct{}{} })
+	}()
+	waitForChange := func() {
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the watcher.")
+		}
+	}
+	// Give the watcher time to register the directory.
+	time.Sleep(200 * time.Millisecond)
+
+	err := copyMp3(c.Config.MusicDirectory, "test1.mp3")
+	assert.NoError(t, err, "Failed copying file.")
+	waitForChange()
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 1, "Expected a new file to be inserted.")
+	report, ok, err := c.LastScanReport()
+	assert.NoError(t, err, "Expected no error getting the scan report.")
+	assert.True(t, ok, "Expected the changes to be saved as a scan report.")
+	assert.Equal(t, 1, report.Added, "Expected the report of the changes.")
+
+	err = os.Remove(filepath.Join(c.Config.MusicDirectory, "test1.mp3"))
+	assert.NoError(t, err, "Failed removing file.")
+	waitForChange()
+	songs, err = c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 1, "Expected removed songs to be kept.")
+	assert.True(t, songs[0].Missing, "Expected a removed file to be missing.")
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled, "Expected watching to stop when cancelled.")
+}
+
+func TestControllerWatchWhileMining(t *testing.T) {
+	c := setupMiningController(t, []string{"test2.mp3"})
+	c.Config.WatchDelay = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 10)
+	go c.Watch(ctx, func() { changed <- struct{}{} })
+	// Give the watcher time to register the directory.
+	time.Sleep(200 * time.Millisecond)
+
+	err := copyMp3(c.Config.MusicDirectory, "test1.mp3")
+	assert.NoError(t, err, "Failed copying file.")
+	_, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected mining to wait for the changes being applied.")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the watcher.")
+	}
+
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 2, "Expected each file to be stored once.")
+}
+
+func TestControllerMineMetadataCredits(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3"})
+	_, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 1, "Expected the file to be inserted.")
+	song := songs[0]
+	assert.Equal(t, 5, song.Disc, "Expected the disc number to be stored.")
+	assert.Equal(t, "Test Compositor", song.Composer, "Expected the composer to be stored.")
+	assert.Equal(t, "C", song.Comment, "Expected the comment to be stored.")
+	assert.Empty(t, song.AlbumArtistName, "Expected no album artist for a file without one.")
+
+	search := func(query string) int {
+		count, err := c.CountSearchSongs(query)
+		assert.NoError(t, err, "Expected no error searching %s.", query)
+		return count
+	}
+	assert.Equal(t, 1, search("co:Compositor"), "Expected to find the song by its composer.")
+	assert.Equal(t, 1, search("di:5"), "Expected to find the song by its disc.")
+	assert.Equal(t, 0, search("aa:Orchestra"), "Expected no album artist yet.")
+
+	err = c.EditAlbumArtist(song.AlbumID, "Various Orchestra")
+	assert.NoError(t, err, "Expected no error editing the album artist.")
+	err = c.EditSongCredits(song.ID, 2, "First Composer; Second Composer", "Live")
+	assert.NoError(t, err, "Expected no error editing the song credits.")
+
+	song, err = c.DB.GetSong(song.ID)
+	assert.NoError(t, err, "Expected no error getting the song.")
+	assert.Equal(t, "Various Orchestra", song.AlbumArtistName, "Expected the album artist to be edited.")
+	assert.Equal(t, 2, song.Disc, "Expected the disc number to be edited.")
+	assert.Equal(t, "Live", song.Comment, "Expected the comment to be edited.")
+	composers, err := c.DB.GetCredits(song.ID, model.RoleComposer)
+	assert.NoError(t, err, "Expected no error getting the composers.")
+	assert.Len(t, composers, 2, "Expected both composers to be credited.")
+	assert.Equal(t, 1, search("aa:Orchestra"), "Expected to find the song by its album artist.")
+	assert.Equal(t, 1, search("co:Second"), "Expected to find the song by any composer.")
+	assert.Equal(t, 0, search("co:Compositor"), "Expected the old composer to be replaced.")
+	assert.Equal(t, 1, search("cm:Live"), "Expected to find the song by its comment.")
+}
+
+func TestControllerMineMetadataAlbumIdentity(t *testing.T) {
+	c := setupMiningController(t, nil)
+	for _, dir := range []string{"first", "second"} {
+		err := os.MkdirAll(filepath.Join(c.Config.MusicDirectory, dir), os.ModePerm)
+		assert.NoError(t, err, "Failed creating directory.")
+	}
+	err := createTempDirectoryWithFiles(c.Config.MusicDirectory, []string{"first/1.mp3", "first/2.mp3", "second/1.mp3"})
+	assert.NoError(t, err, "Failed copying files.")
+	countAlbums := func() int {
+		var albums int
+		err := c.DB.Db.QueryRow(`SELECT count(*) FROM albums`).Scan(&albums)
+		assert.NoError(t, err, "Expected no error counting albums.")
+		return albums
+	}
+
+	_, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	assert.Equal(t, 2, countAlbums(), "Expected an album per directory.")
+
+	c.Config.AlbumIdentity = model.AlbumByArtist
+	_, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	assert.Equal(t, 1, countAlbums(), "Expected a change of strategy to regroup the albums.")
+
+	c.Config.AlbumIdentity = "unknown"
+	_, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.Error(t, err, "Expected an unknown strategy to be refused.")
+}
+
+func TestControllerMineMetadataMissingTags(t *testing.T) {
+	c := setupMiningController(t, []string{"tagged.mp3"})
+	untagged, err := os.ReadFile(filepath.Join("..", "..", "testdata", "testdata_without_tags_sample.mp3"))
+	assert.NoError(t, err, "Failed reading untagged file.")
+	err = os.WriteFile(filepath.Join(c.Config.MusicDirectory, "untagged.mp3"), untagged, 0644)
+	assert.NoError(t, err, "Failed writing untagged file.")
+	_, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+
+	songs, err := c.GetSearchSongs("mi:any", model.SearchOptions{})
+	assert.NoError(t, err, "Expected no error searching missing metadata.")
+	assert.Len(t, songs, 1, "Expected only the untagged file to miss metadata.")
+	song := songs[0]
+	assert.Empty(t, song.Title, "Expected no made up title.")
+	assert.Empty(t, song.PerformerName, "Expected no made up performer.")
+	assert.Zero(t, song.PerformerID, "Expected no performer.")
+	assert.Zero(t, song.AlbumID, "Expected no album.")
+	assert.Zero(t, song.Year, "Expected no made up year.")
+	assert.Zero(t, song.Track, "Expected no made up track.")
+
+	var nulls int
+	query := `SELECT count(*) FROM rolas WHERE title IS NULL AND year IS NULL AND track IS NULL AND id_performer IS NULL`
+	err = c.DB.Db.QueryRow(query).Scan(&nulls)
+	assert.NoError(t, err, "Expected no error counting NULL tags.")
+	assert.Equal(t, 1, nulls, "Expected missing tags to be stored as NULL.")
+	performerID, err := c.DB.GetPerformerID("Unknown")
+	assert.NoError(t, err, "Expected no error getting performer.")
+	assert.Zero(t, performerID, "Expected no placeholder performer.")
+
+	count, err := c.CountSearchSongs("mi:ye")
+	assert.NoError(t, err, "Expected no error searching missing years.")
+	assert.Equal(t, 1, count, "Expected the untagged file to miss its year.")
+	_, err = c.CountSearchSongs("mi:nothing")
+	var queryErr *controller.QueryError
+	assert.ErrorAs(t, err, &queryErr, "Expected an unknown field to be a query error.")
+
+	report, err := c.MissingMetadataReport()
+	assert.NoError(t, err, "Expected no error building the report.")
+	assert.Len(t, report, len(model.MissingFields)+1, "Expected a line per field and one for any field.")
+	for _, line := range report {
+		assert.Equal(t, 1, line.Count, "Expected the untagged file to miss %s.", line.Field)
+		count, err := c.CountSearchSongs(line.Search)
+		assert.NoError(t, err, "Expected the report search %s to be valid.", line.Search)
+		assert.Equal(t, line.Count, count, "Expected the report search %s to list the songs.", line.Search)
+	}
+}
+
+func TestFilenamePattern(t *testing.T) {
+	pattern, err := model.CompilePattern("%artist%/%album% (%year%)/%track% - %title%.mp3")
+	assert.NoError(t, err, "Expected a valid pattern.")
+
+	values, ok := pattern.Match(filepath.Join("music", "Queen", "Jazz (1978)", "03 - Jealousy.flac"))
+	assert.True(t, ok, "Expected the path to follow the pattern.")
+	assert.Equal(t, map[string]string{"artist": "Queen", "album": "Jazz", "year": "1978", "track": "03", "title": "Jealousy"},
+		values, "Expected every placeholder to be found.")
+
+	_, ok = pattern.Match(filepath.Join("Queen", "Jazz", "03 - Jealousy.mp3"))
+	assert.False(t, ok, "Expected a path without a year not to follow the pattern.")
+
+	_, err = model.CompilePattern("%artist%/%unknown%.mp3")
+	assert.Error(t, err, "Expected an unknown placeholder to be refused.")
+	_, err = model.CompilePattern("music.mp3")
+	assert.Error(t, err, "Expected a pattern without placeholders to be refused.")
+}
+
+func TestControllerMineMetadataFilenamePatterns(t *testing.T) {
+	c := setupMiningController(t, nil)
+	albumDir := filepath.Join(c.Config.MusicDirectory, "Queen", "Jazz (1978)")
+	err := os.MkdirAll(albumDir, os.ModePerm)
+	assert.NoError(t, err, "Failed creating directory.")
+	untagged, err := os.ReadFile(filepath.Join("..", "..", "testdata", "testdata_without_tags_sample.mp3"))
+	assert.NoError(t, err, "Failed reading untagged file.")
+	err = os.WriteFile(filepath.Join(albumDir, "03 - Jealousy.mp3"), untagged, 0644)
+	assert.NoError(t, err, "Failed writing untagged file.")
+	err = copyMp3(albumDir, "04 - Tagged.mp3")
+	assert.NoError(t, err, "Failed copying tagged file.")
+	c.Config.FilenamePatterns = []string{"%artist%/%album% (%year%)/%track% - %title%.mp3"}
+
+	previews, err := c.PreviewInferredTags(c.Config.MusicDirectory)
+	assert.NoError(t, err, "Expected no error previewing inferred tags.")
+	assert.Len(t, previews, 2, "Expected a preview per file.")
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Empty(t, songs, "Expected the preview not to change the database.")
+
+	_, err = c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	songs, err = c.GetSearchSongs("tr:1..", model.SearchOptions{SortBy: model.SortTrack})
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 2, "Expected both files to be mined.")
+	assert.Equal(t, "Jealousy", songs[0].Title, "Expected the title to be inferred.")
+	assert.Equal(t, "Queen", songs[0].PerformerName, "Expected the artist to be inferred.")
+	assert.Equal(t, "Jazz", songs[0].AlbumName, "Expected the album to be inferred.")
+	assert.Equal(t, 1978, songs[0].Year, "Expected the year to be inferred.")
+	assert.Equal(t, 3, songs[0].Track, "Expected the track to be inferred.")
+	assert.Equal(t, "Test Title", songs[1].Title, "Expected existing tags to be kept in fallback mode.")
+
+	c.Config.FilenameMode = model.PatternOverride
+	previews, err = c.PreviewInferredTags(c.Config.MusicDirectory)
+	assert.NoError(t, err, "Expected no error previewing inferred tags.")
+	for _, preview := range previews {
+		if filepath.Base(preview.File) == "04 - Tagged.mp3" {
+			assert.Equal(t, "Tagged", preview.Metadata.Title, "Expected the tags to be replaced in override mode.")
+			assert.Contains(t, preview.Inferred, "title", "Expected the title to be listed as inferred.")
+		}
+	}
+
+	c.Config.FilenameMode = "sometimes"
+	_, err = c.PreviewInferredTags(c.Config.MusicDirectory)
+	assert.Error(t, err, "Expected an unknown mode to be refused.")
+}
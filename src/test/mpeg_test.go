@@ -0,0 +1,132 @@
+package test
+
+import (
+	"testing"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"time"
+	"github.com/KevinJGard/MusicDB/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// mpegFrame returns a 417 byte MPEG-1 Layer III frame at 128 kbps, 44100 Hz and joint stereo.
+func mpegFrame() []byte {
+	return append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 413)...)
+}
+
+// mpegStream returns the given first frame followed by count frames.
+func mpegStream(first []byte, count int) []byte {
+	stream := append([]byte{}, first...)
+	for i := 0; i < count; i++ {
+		stream = append(stream, mpegFrame()...)
+	}
+	return stream
+}
+
+func TestReadMPEGPropertiesCBR(t *testing.T) {
+	stream := mpegStream(mpegFrame(), 99)
+	stream = append(stream, append([]byte("TAG"), make([]byte, 125)...)...)
+
+	properties, err := model.ReadMPEGProperties(bytes.NewReader(stream))
+	assert.NoError(t, err, "Expected no error reading the properties.")
+	assert.Equal(t, 128, properties.Bitrate, "Expected the bitrate of the frames.")
+	assert.Equal(t, 44100, properties.SampleRate, "Expected the sample rate of the frames.")
+	assert.Equal(t, "joint stereo", properties.Channels, "Expected the channel mode of the frames.")
+	assert.False(t, properties.VBR, "Expected a constant bitrate.")
+	assert.InDelta(t, 100*417*8/128000.0, properties.Duration.Seconds(), 0.001, "Expected the duration from the size without the ID3v1 tag.")
+}
+
+func TestReadMPEGPropertiesXing(t *testing.T) {
+	first := mpegFrame()
+	copy(first[36:], "Xing")
+	binary.BigEndian.PutUint32(first[40:], 3)
+	binary.BigEndian.PutUint32(first[44:], 1000)
+	binary.BigEndian.PutUint32(first[48:], 1000000)
+	copy(first[52:], "LAME3.100")
+
+	properties, err := model.ReadMPEGProperties(bytes.NewReader(mpegStream(first, 10)))
+	assert.NoError(t, err, "Expected no error reading the properties.")
+	seconds := 1000 * 1152 / 44100.0
+	assert.InDelta(t, seconds, properties.Duration.Seconds(), 0.001, "Expected the duration from the number of frames.")
+	assert.True(t, properties.VBR, "Expected a variable bitrate.")
+	assert.Equal(t, int(1000000*8/seconds/1000+0.5), properties.Bitrate, "Expected the average bitrate.")
+	assert.Equal(t, "LAME3.100", properties.Encoder, "Expected the encoder of the LAME header.")
+
+	copy(first[36:], "Info")
+	properties, err = model.ReadMPEGProperties(bytes.NewReader(mpegStream(first, 10)))
+	assert.NoError(t, err, "Expected no error reading the properties.")
+	assert.False(t, properties.VBR, "Expected an Info header to mean a constant bitrate.")
+	assert.Equal(t, 128, properties.Bitrate, "Expected the bitrate of the frames.")
+	assert.InDelta(t, seconds, properties.Duration.Seconds(), 0.001, "Expected the duration from the number of frames.")
+}
+
+func TestReadMPEGPropertiesVBRI(t *testing.T) {
+	first := mpegFrame()
+	copy(first[36:], "VBRI")
+	binary.BigEndian.PutUint32(first[46:], 500000)
+	binary.BigEndian.PutUint32(first[50:], 500)
+
+	properties, err := model.ReadMPEGProperties(bytes.NewReader(mpegStream(first, 10)))
+	assert.NoError(t, err, "Expected no error reading the properties.")
+	assert.True(t, properties.VBR, "Expected a variable bitrate.")
+	assert.InDelta(t, 500*1152/44100.0, properties.Duration.Seconds(), 0.001, "Expected the duration from the number of frames.")
+	assert.Empty(t, properties.Encoder, "Expected no encoder without a LAME header.")
+}
+
+func TestReadMPEGPropertiesAfterID3(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.mp3")
+	stream := append([]byte("junk"), mpegStream(mpegFrame(), 9)...)
+	err := os.WriteFile(file, stream, 0644)
+	assert.NoError(t, err, "Failed to write the file.")
+	err = model.WriteID3Tags(file, model.ID3Tags{Title: "Tagged"}, 4)
+	assert.NoError(t, err, "Failed to tag the file.")
+
+	metadata, err := model.NewMiner().ReadTags(file)
+	assert.NoError(t, err, "Expected no error reading the file.")
+	assert.Equal(t, 44100, metadata.Audio.SampleRate, "Expected the frames to be found after the tag and junk.")
+	assert.InDelta(t, 10*417*8/128000.0, metadata.Audio.Duration.Seconds(), 0.001, "Expected the duration of the frames.")
+
+	_, err = model.ReadMPEGProperties(bytes.NewReader([]byte("not audio at all")))
+	assert.ErrorIs(t, err, model.ErrNoMPEGFrames, "Expected no frames to be found.")
+}
+
+func TestReadTagsBrokenID3Frame(t *testing.T) {
+	// An ID3v2.3 tag whose TALB frame claims more bytes than the tag holds.
+	frames := append([]byte("TIT2\x00\x00\x00\x05\x00\x00\x00abcd"), []byte("TALB\x00\x00\x01\x00\x00\x00\x00ef")...)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frames))}, frames...)
+	file := filepath.Join(t.TempDir(), "test.mp3")
+	err := os.WriteFile(file, append(tag, mpegStream(mpegFrame(), 9)...), 0644)
+	assert.NoError(t, err, "Failed to write the file.")
+
+	metadata, err := model.NewMiner().ReadTags(file)
+	assert.NoError(t, err, "Expected a broken frame not to fail the file.")
+	assert.Equal(t, "abcd", metadata.Title, "Expected the readable frames to be read.")
+	assert.Equal(t, 44100, metadata.Audio.SampleRate, "Expected the frames to be found after the tag.")
+}
+
+func TestAudioPropertiesString(t *testing.T) {
+	properties := model.AudioProperties{Duration: 205400 * time.Millisecond, Bitrate: 245, SampleRate: 44100,
+		Channels: "joint stereo", VBR: true, Encoder: "LAME3.100"}
+	assert.Equal(t, "3:25, 245 kbps VBR, 44100 Hz, joint stereo, LAME3.100", properties.String(), "Expected every property.")
+	assert.Equal(t, "1:01:01", model.AudioProperties{Duration: 3661 * time.Second}.String(), "Expected hours for long songs.")
+	assert.Empty(t, model.AudioProperties{}.String(), "Expected nothing for unknown properties.")
+}
+
+func TestControllerMineMetadataAudioProperties(t *testing.T) {
+	c := setupMiningController(t, []string{"test1.mp3"})
+	_, err := c.MineMetadata(context.Background(), func(int) {}, func() {})
+	assert.NoError(t, err, "Expected no error mining metadata.")
+	songs, err := c.GetSongs()
+	assert.NoError(t, err, "Expected no error getting songs.")
+	assert.Len(t, songs, 1, "Expected the file to be inserted.")
+
+	song := songs[0]
+	assert.InDelta(t, 5.04, song.Duration.Seconds(), 0.05, "Expected the duration to be stored.")
+	assert.Equal(t, 64, song.Bitrate, "Expected the bitrate to be stored.")
+	assert.Equal(t, 48000, song.SampleRate, "Expected the sample rate to be stored.")
+	assert.Equal(t, "stereo", song.Channels, "Expected the channel mode to be stored.")
+	assert.Contains(t, song.Encoder, "Lavc", "Expected the encoder to be stored.")
+}
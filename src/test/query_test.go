@@ -0,0 +1,164 @@
+package test
+
+import (
+	"testing"
+	"os"
+	"github.com/KevinJGard/MusicDB/src/controller"
+	"github.com/KevinJGard/MusicDB/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestController(t *testing.T) *controller.Controller {
+	os.Setenv("HOME", t.TempDir())
+	c := controller.NewController()
+	t.Cleanup(func() { c.DB.Db.Close() })
+
+	songs := []struct {
+		performer, album, title, genre string
+		track, year int
+	}{
+		{"Michael Jackson", "Thriller", "Beat It", "Pop", 5, 1982},
+		{"Michael Jackson", "Bad", "Bad", "Pop", 1, 1987},
+		{"Jose Jose", "Secretos", "Lo Dudo", "Balada", 3, 1983},
+		{"Coldplay", "Parachutes", "Yellow", "Rock", 10, 1986},
+	}
+	for _, song := range songs {
+		performerID, err := c.DB.InsertPerformerIfNotExists(song.performer, 0)
+		assert.NoError(t, err, "Failed inserting performer.")
+		albumID, err := c.DB.InsertAlbumIfNotExists(song.album, song.year, "/path/"+song.album)
+		assert.NoError(t, err, "Failed inserting album.")
+		_, err = c.DB.InsertSongIfNotExists(performerID, albumID, "/path/"+song.title+".mp3", song.title, song.genre, song.track, song.year)
+		assert.NoError(t, err, "Failed inserting song.")
+	}
+	return c
+}
+
+func searchTitles(t *testing.T, c *controller.Controller, search string) []string {
+	songs, err := c.GetSearchSongs(search, model.SearchOptions{})
+	assert.NoError(t, err, "Expected no error searching '%s'.", search)
+	return titlesOf(songs)
+}
+
+func titlesOf(songs []model.Song) []string {
+	titles := []string{}
+	for _, song := range songs {
+		titles = append(titles, song.Title)
+	}
+	return titles
+}
+
+func TestSearchBooleanOperators(t *testing.T) {
+	c := setupTestController(t)
+
+	assert.ElementsMatch(t, []string{"Bad"}, searchTitles(t, c, "ge:Pop AND ye:1987"), "Expected AND to require both terms.")
+	assert.ElementsMatch(t, []string{"Bad"}, searchTitles(t, c, "ge:Pop && ye:1987"), "Expected && to behave as AND.")
+	assert.ElementsMatch(t, []string{"Bad", "Yellow"}, searchTitles(t, c, "ye:1987 OR ye:1986"), "Expected OR to join results.")
+	assert.ElementsMatch(t, []string{"Beat It"}, searchTitles(t, c, "ar:Michael NOT ti:Bad"), "Expected NOT to exclude songs.")
+	assert.ElementsMatch(t, []string{"Beat It"}, searchTitles(t, c, "ar:Michael -ti:Bad"), "Expected '-' to behave as NOT.")
+	assert.ElementsMatch(t, []string{"Bad", "Lo Dudo"}, searchTitles(t, c, "(ar:Jose || ti:Bad) -ye:1982"), "Expected parentheses to group terms.")
+	assert.ElementsMatch(t, []string{"Bad", "Beat It", "Yellow"}, searchTitles(t, c, "ar:(Coldplay OR \"Michael Jackson\")"), "Expected a field to apply to a group.")
+	assert.ElementsMatch(t, []string{"Lo Dudo"}, searchTitles(t, c, "\"Jose Jose\""), "Expected quoted phrases to match.")
+	assert.ElementsMatch(t, []string{"Beat It", "Bad"}, searchTitles(t, c, "michael pop"), "Expected words without a field to match any field.")
+}
+
+func TestSearchNotMatchesNull(t *testing.T) {
+	c := setupTestController(t)
+	_, err := c.DB.InsertSongIfNotExists(0, 0, "/path/Untagged.mp3", "Untagged", "", 0, 0)
+	assert.NoError(t, err, "Failed inserting song.")
+
+	assert.ElementsMatch(t, []string{"Lo Dudo", "Yellow", "Untagged"}, searchTitles(t, c, "-ge:Pop"), "Expected songs without a genre not to be Pop.")
+	assert.ElementsMatch(t, []string{"Untagged"}, searchTitles(t, c, "ti:Untagged NOT ar:Michael"), "Expected songs without a performer not to be by Michael.")
+	assert.ElementsMatch(t, []string{"Bad", "Beat It", "Lo Dudo", "Yellow", "Untagged"}, searchTitles(t, c, "-ye:1980..1981"), "Expected songs without a year to be outside any range.")
+}
+
+func TestSearchNumberRanges(t *testing.T) {
+	c := setupTestController(t)
+
+	assert.ElementsMatch(t, []string{"Beat It", "Lo Dudo"}, searchTitles(t, c, "ye:1980..1983"), "Expected inclusive year range.")
+	assert.ElementsMatch(t, []string{"Beat It"}, searchTitles(t, c, "ye:..1982"), "Expected range open at the start.")
+	assert.ElementsMatch(t, []string{"Bad", "Yellow"}, searchTitles(t, c, "ye:1986.."), "Expected range open at the end.")
+	assert.ElementsMatch(t, []string{"Bad", "Yellow"}, searchTitles(t, c, "ye:>=1986"), "Expected greater or equal comparison.")
+	assert.ElementsMatch(t, []string{"Yellow"}, searchTitles(t, c, "ye:>1982 ye:<1987 ge:Rock"), "Expected comparisons to combine.")
+	assert.ElementsMatch(t, []string{"Bad", "Lo Dudo"}, searchTitles(t, c, "tr:<5"), "Expected comparisons on track numbers.")
+	assert.ElementsMatch(t, []string{"Bad"}, searchTitles(t, c, "tr:=1"), "Expected explicit equality.")
+	assert.ElementsMatch(t, []string{"Beat It", "Yellow"}, searchTitles(t, c, "tr:5..10"), "Expected inclusive track range.")
+}
+
+func TestSearchResultsAreUnique(t *testing.T) {
+	c := setupTestController(t)
+
+	songs, err := c.GetSearchSongs("ti:Bad || ar:Michael || ge:Pop", model.SearchOptions{})
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Len(t, songs, 2, "Expected songs matching several terms to appear once.")
+}
+
+func TestSearchSortAndPages(t *testing.T) {
+	c := setupTestController(t)
+
+	options := model.SearchOptions{SortBy: model.SortYear}
+	songs, err := c.GetSearchSongs("ye:>0", options)
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Equal(t, []string{"Beat It", "Lo Dudo", "Yellow", "Bad"}, titlesOf(songs), "Expected songs ordered by year.")
+
+	options = model.SearchOptions{SortBy: model.SortTrack, Descending: true}
+	songs, err = c.GetSearchSongs("ye:>0", options)
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Equal(t, []string{"Yellow", "Beat It", "Lo Dudo", "Bad"}, titlesOf(songs), "Expected songs ordered by descending track.")
+
+	options = model.SearchOptions{SortBy: model.SortArtist}
+	songs, err = c.GetSearchSongs("ye:>0", options)
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Equal(t, []string{"Yellow", "Lo Dudo", "Bad", "Beat It"}, titlesOf(songs), "Expected songs ordered by artist, then album.")
+
+	options = model.SearchOptions{SortBy: model.SortTitle, Limit: 3, Offset: 3}
+	songs, err = c.GetSearchSongs("ye:>0", options)
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Equal(t, []string{"Yellow"}, titlesOf(songs), "Expected the second page to hold the last song.")
+
+	count, err := c.CountSearchSongs("ye:>0")
+	assert.NoError(t, err, "Expected no error counting.")
+	assert.Equal(t, 4, count, "Expected every song to be counted.")
+}
+
+func TestSearchErrorsHavePositions(t *testing.T) {
+	c := setupTestController(t)
+
+	cases := []struct {
+		search string
+		position int
+	}{
+		{"ti:Bad || xx:Pop", 11},
+		{"ar:\"Michael", 4},
+		{"(ti:Bad OR ti:Yellow", 1},
+		{"ti:Bad )", 8},
+		{"ye:nineteen", 4},
+		{"ti:Bad AND", 11},
+		{"ar:", 1},
+		{"ti:Bad ye:1990..1980", 11},
+		{"tr:>=x", 4},
+		{"ye:..", 4},
+		{"ye:\"1986\"", 4},
+	}
+	for _, tc := range cases {
+		_, err := c.GetSearchSongs(tc.search, model.SearchOptions{})
+		if assert.Error(t, err, "Expected an error searching '%s'.", tc.search) {
+			queryErr, ok := err.(*controller.QueryError)
+			assert.True(t, ok, "Expected a QueryError for '%s'.", tc.search)
+			if ok {
+				assert.Equal(t, tc.position, queryErr.Position, "Expected error position to match for '%s'.", tc.search)
+			}
+		}
+	}
+}
+
+func TestBuildSearchFilterIsParameterized(t *testing.T) {
+	c := setupTestController(t)
+
+	filter, err := controller.BuildSearchFilter(c.DB, "ti:\"x' OR 1=1 --\"")
+	assert.NoError(t, err, "Expected no error building the filter.")
+	assert.NotContains(t, filter.Where, "1=1", "Expected values to be passed as arguments.")
+
+	songs, err := c.DB.FilterSongs(filter, model.SearchOptions{})
+	assert.NoError(t, err, "Expected no error filtering songs.")
+	assert.Empty(t, songs, "Expected no song to match.")
+}
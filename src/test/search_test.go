@@ -0,0 +1,81 @@
+package test
+
+import (
+	"testing"
+	"path/filepath"
+	"github.com/KevinJGard/MusicDB/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullTextSearch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Db.Close()
+	assertInsert(t, db)
+
+	songs, err := db.FullTextSearch("son")
+	assert.NoError(t, err, "Expected no error searching by prefix.")
+	assert.Len(t, songs, 1, "Expected one song returned.")
+	assert.Equal(t, "song1", songs[0].Title, "Expected song title to match.")
+
+	songs, err = db.FullTextSearch("Test Perf pop")
+	assert.NoError(t, err, "Expected no error searching several words.")
+	assert.Len(t, songs, 1, "Expected words to match across fields.")
+
+	songs, err = db.FullTextSearch("song1 Jazz")
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Empty(t, songs, "Expected every word to be required.")
+}
+
+func TestFullTextSearchFollowsRenames(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Db.Close()
+	assertInsert(t, db)
+
+	err := db.UpdateNamePerformer(1, "Renamed Artist")
+	assert.NoError(t, err, "Expected no error renaming performer.")
+
+	songs, err := db.FullTextSearch("renamed")
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Len(t, songs, 1, "Expected the index to follow the performer's new name.")
+	assert.Equal(t, "Renamed Artist", songs[0].PerformerName, "Expected performer name to match.")
+}
+
+func TestFullTextSearchRanking(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Db.Close()
+	assertInsert(t, db)
+	if !db.HasSearchIndex() {
+		t.Skip("SQLite was built without FTS5, build with -tags sqlite_fts5.")
+	}
+
+	_, err := db.InsertSongIfNotExists(1, 1, "/path/test/song2.mp3", "Other", "song", 1, 1901)
+	assert.NoError(t, err, "Failed inserting song.")
+
+	songs, err := db.FullTextSearch("song")
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Len(t, songs, 2, "Expected both songs returned.")
+	assert.Equal(t, "song1", songs[0].Title, "Expected title matches to rank first.")
+}
+
+func TestFullTextSearchUpgradesIndex(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "music.db")
+	db, err := model.OpenDataBase(dbFile)
+	assert.NoError(t, err, "Failed opening database.")
+	if !db.HasSearchIndex() {
+		db.Db.Close()
+		t.Skip("SQLite was built without FTS5, build with -tags sqlite_fts5.")
+	}
+	assertInsert(t, db)
+	_, err = db.Db.Exec(`DROP TABLE songs_fts`)
+	assert.NoError(t, err, "Failed dropping index.")
+	_, err = db.Db.Exec(`CREATE VIRTUAL TABLE songs_fts USING fts5(title, performer, album, genre)`)
+	assert.NoError(t, err, "Failed creating an outdated index.")
+	db.Db.Close()
+
+	db, err = model.OpenDataBase(dbFile)
+	assert.NoError(t, err, "Expected the outdated index to be replaced.")
+	defer db.Db.Close()
+	songs, err := db.FullTextSearch("song1")
+	assert.NoError(t, err, "Expected no error searching.")
+	assert.Len(t, songs, 1, "Expected existing songs to be indexed again.")
+}
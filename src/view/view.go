@@ -1,12 +1,16 @@
 package view
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"errors"
 	"strconv"
+	"strings"
+	"time"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/widget"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/container"
@@ -14,6 +18,7 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/data/validation"
 	"github.com/KevinJGard/MusicDB/src/controller"
+	"github.com/KevinJGard/MusicDB/src/model"
 )
 
 // Run_View initializes and starts the main application window.
@@ -33,33 +38,98 @@ func Run_View() {
 	progress = widget.NewProgressBar()
 	loading := widget.NewLabel("Getting metadata...")
 	loading.TextStyle = fyne.TextStyle{Monospace: true}
-	progressContainer = container.NewVBox(loading, progress,)
+	cancelMining := func() {}
+	cancelButton := widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), func() {
+		cancelMining()
+	})
+	progressContainer = container.NewVBox(loading, progress, container.NewCenter(cancelButton))
 	progressContainer.Hide()
 	mineMetadata := func() {
+		if progressContainer.Visible() {
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelMining = cancel
 		progress.SetValue(0) 
+		loading.SetText("Getting metadata...")
 		progressContainer.Show() 
 
 		go func() {
-			err := controller.MineMetadata(
+			defer cancel()
+			report, err := controller.MineMetadata(ctx,
 				func(pro int) {
 					progress.SetValue(float64(pro) / 100.0)
 					myWindow.Content().Refresh()
 				}, 
 				func() {
-					dialog.ShowInformation("Completed", "Data was mined.", myWindow)
 					progressContainer.Hide()
 					updateList()
 				},
 			)
 
-			if err != nil {
+			if err == nil {
+				showScanReport(report, myWindow)
+			} else if errors.Is(err, context.Canceled) {
+				dialog.ShowInformation("Cancelled", "Mining was cancelled.", myWindow)
+				progressContainer.Hide()
+				updateList()
+			} else if err != nil {
 				dialog.ShowError(err, myWindow)
 				progressContainer.Hide()
 			}
 		}()
 	}
 
-	menu := createMainMenu(myApp, myWindow, mineMetadata, controller)
+	syncTags := func() {
+		if progressContainer.Visible() {
+			return
+		}
+		dialog.ShowConfirm("Sync database to files", "Write the tags of every MP3 song in the database into its file?", func(ok bool) {
+			if !ok {
+				return
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancelMining = cancel
+			progress.SetValue(0)
+			loading.SetText("Writing tags...")
+			progressContainer.Show()
+
+			go func() {
+				defer cancel()
+				written, err := controller.SyncTagsToFiles(ctx, func(pro int) {
+					progress.SetValue(float64(pro) / 100.0)
+				})
+				progressContainer.Hide()
+				if errors.Is(err, context.Canceled) {
+					dialog.ShowInformation("Cancelled", fmt.Sprintf("Writing was cancelled after %d files.", written), myWindow)
+				} else if err != nil {
+					dialog.ShowError(err, myWindow)
+				} else {
+					dialog.ShowInformation("Completed", fmt.Sprintf("Tags were written to %d files.", written), myWindow)
+				}
+			}()
+		}, myWindow)
+	}
+
+	var stopWatching context.CancelFunc
+	toggleWatch := func() bool {
+		if stopWatching != nil {
+			stopWatching()
+			stopWatching = nil
+			return false
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		stopWatching = cancel
+		go func() {
+			err := controller.Watch(ctx, updateList)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				dialog.ShowError(err, myWindow)
+			}
+		}()
+		return true
+	}
+
+	menu := createMainMenu(myApp, myWindow, mineMetadata, syncTags, updateList, toggleWatch, controller)
 	myWindow.SetMainMenu(menu)
 
 	content := container.New(layout.NewBorderLayout(searchContainer, contSouth, nil, nil),
@@ -93,23 +163,98 @@ func createSearchContainer(myWindow fyne.Window, controller *controller.Controll
 	return container.NewGridWithColumns(2, searchEntry, searchButton)
 }
 
-// openSongsFound creates a new window displaying the found songs based on the search query.
+// searchPageSize is the number of songs shown on each page of the search results.
+const searchPageSize = 100
+
+// sortLabels holds the name shown to the user for each sort key.
+var sortLabels = map[model.SortKey]string{
+	model.SortRelevance: "Relevance",
+	model.SortTitle:     "Title",
+	model.SortArtist:    "Artist",
+	model.SortAlbum:     "Album",
+	model.SortYear:      "Year",
+	model.SortTrack:     "Track",
+}
+
+// openSongsFound creates a new window displaying the found songs based on the search query,
+// with controls to sort them and to move between pages.
 func openSongsFound(controller *controller.Controller, myApp fyne.App, search string) {
+	var (
+		previous *widget.Button
+		next *widget.Button
+	)
 	songsFound := myApp.NewWindow("Songs Found")
 	songsFound.SetIcon(theme.SearchIcon())
 	songsFound.Resize(fyne.NewSize(1000, 600))
 
+	options := &model.SearchOptions{Limit: searchPageSize}
 	songsLabel := widget.NewLabelWithStyle("Songs Found", fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
 	songsIcon := widget.NewIcon(theme.SearchIcon())
 	north := container.NewHBox(songsLabel, songsIcon)
 	center := container.NewCenter(north)
-	cont, contSouth := createListContainerBySearch(controller, songsFound, myApp, search)
-	editContent := container.New(layout.NewBorderLayout(center, contSouth, nil, nil),
-		center, cont, contSouth)
+	cont, contSouth, updateList := createListContainerBySearch(controller, songsFound, myApp, search, options)
+
+	pageLabel := widget.NewLabel("")
+	refresh := func() {
+		total, err := controller.CountSearchSongs(search)
+		if err != nil {
+			dialog.ShowError(err, songsFound)
+			return
+		}
+		updateList()
+		pages := (total + searchPageSize - 1) / searchPageSize
+		if pages == 0 {
+			pages = 1
+		}
+		pageLabel.SetText(fmt.Sprintf("Page %d of %d (%d songs)", options.Offset/searchPageSize+1, pages, total))
+		if options.Offset > 0 {
+			previous.Enable()
+		} else {
+			previous.Disable()
+		}
+		if options.Offset+searchPageSize < total {
+			next.Enable()
+		} else {
+			next.Disable()
+		}
+	}
+	previous = widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() {
+		options.Offset -= searchPageSize
+		refresh()
+	})
+	next = widget.NewButtonWithIcon("", theme.NavigateNextIcon(), func() {
+		options.Offset += searchPageSize
+		refresh()
+	})
+
+	var names []string
+	for _, key := range model.SortKeys {
+		names = append(names, sortLabels[key])
+	}
+	sortSelect := widget.NewSelect(names, func(name string) {
+		for key, label := range sortLabels {
+			if label == name {
+				options.SortBy = key
+			}
+		}
+		options.Offset = 0
+		refresh()
+	})
+	descending := widget.NewCheck("Descending", func(b bool) {
+		options.Descending = b
+		options.Offset = 0
+		refresh()
+	})
+	sortCont := container.NewHBox(widget.NewLabel("Sort by:"), sortSelect, descending, previous, pageLabel, next)
+	top := container.NewVBox(center, container.NewCenter(sortCont))
+
+	editContent := container.New(layout.NewBorderLayout(top, contSouth, nil, nil),
+		top, cont, contSouth)
 
 	songsFound.SetContent(editContent)
 	songsFound.CenterOnScreen()
 	songsFound.Show()
+	sortSelect.SetSelected(sortLabels[model.SortRelevance])
 }
 
 // openSettingsWindow creates a settings window for the application.
@@ -146,7 +291,7 @@ func createThemeButtons(myApp fyne.App) *fyne.Container {
 }
 
 // createMainMenu sets up the main menu of the application.
-func createMainMenu(myApp fyne.App, myWindow fyne.Window, mineMetadata func(), controller *controller.Controller) *fyne.MainMenu {
+func createMainMenu(myApp fyne.App, myWindow fyne.Window, mineMetadata, syncTags, updateList func(), toggleWatch func() bool, controller *controller.Controller) *fyne.MainMenu {
 	menuItemFull := fyne.NewMenuItem("Full screen", func() {
 		myWindow.SetFullScreen(!myWindow.FullScreen())
 	})
@@ -163,8 +308,16 @@ func createMainMenu(myApp fyne.App, myWindow fyne.Window, mineMetadata func(), c
 		_ = myApp.OpenURL(url)
 	})
 	menuItemHelp.Icon = theme.HelpIcon()
+	menuItemGroups := fyne.NewMenuItem("Groups", func() {
+		openGroupsWindow(myApp, controller)
+	})
+	menuItemGroups.Icon = theme.AccountIcon()
+	menuItemMerge := fyne.NewMenuItem("Merge duplicates", func() {
+		openMergeWindow(myApp, controller, updateList)
+	})
+	menuItemMerge.Icon = theme.ContentCopyIcon()
 
-	newMenu2 := fyne.NewMenu("Options", menuItemSettings, menuItemHelp)
+	newMenu2 := fyne.NewMenu("Options", menuItemSettings, menuItemGroups, menuItemMerge, menuItemHelp)
 
 	menuItemSetPath := fyne.NewMenuItem("Set path", func() {
 		setPath(myWindow, controller)
@@ -172,11 +325,109 @@ func createMainMenu(myApp fyne.App, myWindow fyne.Window, mineMetadata func(), c
 	menuItemSetPath.Icon = theme.FolderIcon()
 	menuItemMineMetadata := fyne.NewMenuItem("Mine metadata", mineMetadata)
 	menuItemMineMetadata.Icon = theme.UploadIcon()
+	menuItemReport := fyne.NewMenuItem("Last scan report", func() {
+		report, ok, err := controller.LastScanReport()
+		if err != nil {
+			dialog.ShowError(err, myWindow)
+		} else if !ok {
+			dialog.ShowInformation("Last scan report", "The library was never mined.", myWindow)
+		} else {
+			showScanReport(report, myWindow)
+		}
+	})
+	menuItemReport.Icon = theme.InfoIcon()
+	menuItemSync := fyne.NewMenuItem("Sync database to files", syncTags)
+	menuItemSync.Icon = theme.DocumentSaveIcon()
+
+	menuItemMissing := fyne.NewMenuItem("Missing metadata", func() {
+		showMissingMetadata(myApp, myWindow, controller)
+	})
+	menuItemMissing.Icon = theme.QuestionIcon()
+	menuItemWatch := fyne.NewMenuItem("Watch directory", nil)
+	menuItemWatch.Icon = theme.VisibilityIcon()
 
-	newMenu3 := fyne.NewMenu("Miner", menuItemSetPath, menuItemMineMetadata)
+	newMenu3 := fyne.NewMenu("Miner", menuItemSetPath, menuItemMineMetadata, menuItemReport, menuItemWatch, menuItemMissing, menuItemSync)
+	menuItemWatch.Action = func() {
+		menuItemWatch.Checked = toggleWatch()
+		newMenu3.Refresh()
+	}
 	return fyne.NewMainMenu(menu, newMenu2, newMenu3)
 }
 
+// missingLabels names the fields of the missing metadata report.
+var missingLabels = map[model.SearchField]string{
+	model.FieldAny:       "Any field",
+	model.FieldTitle:     "Title",
+	model.FieldPerformer: "Artist",
+	model.FieldAlbum:     "Album",
+	model.FieldYear:      "Year",
+	model.FieldTrack:     "Track",
+	model.FieldGenre:     "Genre",
+}
+
+// showMissingMetadata shows how many songs miss each field, with a button listing them so
+// their tags can be fixed.
+func showMissingMetadata(myApp fyne.App, myWindow fyne.Window, controller *controller.Controller) {
+	report, err := controller.MissingMetadataReport()
+	if err != nil {
+		dialog.ShowError(err, myWindow)
+		return
+	}
+	rows := container.NewGridWithColumns(3)
+	for _, line := range report {
+		search := line.Search
+		show := widget.NewButtonWithIcon("Show", theme.SearchIcon(), func() {
+			openSongsFound(controller, myApp, search)
+		})
+		if line.Count == 0 {
+			show.Disable()
+		}
+		rows.Add(widget.NewLabel(missingLabels[line.Field]))
+		rows.Add(widget.NewLabel(fmt.Sprintf("%d songs", line.Count)))
+		rows.Add(show)
+	}
+	dialog.ShowCustom("Missing metadata", "Close", rows, myWindow)
+}
+
+// showScanReport shows what a mining did, with the files that failed and why, followed by the
+// warnings.
+func showScanReport(report model.ScanReport, myWindow fyne.Window) {
+	summary := widget.NewLabel(fmt.Sprintf("%s, %s, in %s.\n%d files scanned: %d added, %d updated, %d moved, %d skipped, %d failed.\n%d songs are missing.",
+		report.Directory, report.Started.Format("2006-01-02 15:04"), report.Elapsed.Round(time.Millisecond),
+		report.Scanned, report.Added, report.Updated, report.Moved, report.Skipped, report.Failed, report.Missing))
+	summary.Wrapping = fyne.TextWrapWord
+	if report.Cancelled {
+		summary.SetText(summary.Text + "\nThe mining was cancelled.")
+	} else if report.Error != "" {
+		summary.SetText(summary.Text + "\nThe mining failed: " + report.Error)
+	}
+	var lines []string
+	for _, failure := range report.Failures {
+		lines = append(lines, failure.File+": "+failure.Reason)
+	}
+	for _, warning := range report.Warnings {
+		lines = append(lines, "Warning, "+warning.File+": "+warning.Reason)
+	}
+	var failures fyne.CanvasObject = widget.NewLabel("No file failed.")
+	if len(lines) > 0 {
+		failures = widget.NewList(
+			func() int {
+				return len(lines)
+			},
+			func() fyne.CanvasObject {
+				return widget.NewLabel("Template Object")
+			},
+			func(id widget.ListItemID, item fyne.CanvasObject) {
+				item.(*widget.Label).SetText(lines[id])
+			},
+		)
+	}
+	content := container.NewBorder(summary, nil, nil, nil, failures)
+	scanDialog := dialog.NewCustom("Scan report", "Close", content, myWindow)
+	scanDialog.Resize(fyne.NewSize(700, 400))
+	scanDialog.Show()
+}
+
 // setPath allows the user to select a directory for music files.
 func setPath(myWindow fyne.Window, controller *controller.Controller) {
 	dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
@@ -193,6 +444,49 @@ func setPath(myWindow fyne.Window, controller *controller.Controller) {
 	}, myWindow).Show()
 }
 
+// songLabel returns the text shown for a song in the lists, flagging the songs whose file is missing.
+func songLabel(song model.Song) string {
+	if song.Missing {
+		return orUnknown(song.Title) + " (missing file)"
+	}
+	return orUnknown(song.Title)
+}
+
+// orUnknown returns the text, or a placeholder when the song's file does not have that tag.
+func orUnknown(text string) string {
+	if text == "" {
+		return "Unknown"
+	}
+	return text
+}
+
+// numberOrUnknown returns the number as text, or a placeholder when the song's file does not
+// have that tag.
+func numberOrUnknown(number int) string {
+	if number == 0 {
+		return "Unknown"
+	}
+	return fmt.Sprintf("%d", number)
+}
+
+// newCoverImage creates an image showing a cover picture in a square of the given size.
+func newCoverImage(size float32) *canvas.Image {
+	image := canvas.NewImageFromResource(theme.MediaMusicIcon())
+	image.FillMode = canvas.ImageFillContain
+	image.SetMinSize(fyne.NewSize(size, size))
+	return image
+}
+
+// setCover shows the picture in the given file, or a music icon when the file is empty.
+func setCover(image *canvas.Image, file string) {
+	if file == "" {
+		image.File, image.Resource = "", theme.MediaMusicIcon()
+	} else {
+		image.File, image.Resource = file, nil
+	}
+	image.Refresh()
+}
+
 // createListContainer creates a container to display the list of songs.
 func createListContainer(controller *controller.Controller, myWindow fyne.Window, myApp fyne.App) (*container.Split, *container.Split, func()) {
 	var (
@@ -201,6 +495,7 @@ func createListContainer(controller *controller.Controller, myWindow fyne.Window
 		performerEdit *widget.Button
 	)
 	data := make([]string, 0)
+	var songs []model.Song
 
 	list := widget.NewList(
 		func() int {
@@ -215,11 +510,12 @@ func createListContainer(controller *controller.Controller, myWindow fyne.Window
 	)
 	
 	updateList := func() {
-		songs, err := controller.GetSongs()
+		loaded, err := controller.GetSongs()
 		if err == nil {
+			songs = loaded
 			data = data[:0]
 			for _, song := range songs {
-				data = append(data, song.Title)
+				data = append(data, songLabel(song))
 			}
 		} else {
 			data = append(data, "Error loading songs")
@@ -241,8 +537,17 @@ func createListContainer(controller *controller.Controller, myWindow fyne.Window
 	trackLabel := widget.NewLabel("Track: ")
 	yearLabel := widget.NewLabel("Year: ")
 	genreLabel := widget.NewLabel("Genre: ")
-	detailsCont := container.NewVBox(widget.NewSeparator(), performerCont, widget.NewSeparator(), albumCont, widget.NewSeparator(), 
-				trackLabel, widget.NewSeparator(), yearLabel, widget.NewSeparator(), genreLabel, widget.NewSeparator(), songEdit)
+	formatLabel := widget.NewLabel("Format: ")
+	audioLabel := widget.NewLabel("Audio: ")
+	albumArtistLabel := widget.NewLabel("Album artist: ")
+	discLabel := widget.NewLabel("Disc: ")
+	composerLabel := widget.NewLabel("Composer: ")
+	commentLabel := widget.NewLabel("Comment: ")
+	commentLabel.Wrapping = fyne.TextWrapWord
+	cover := newCoverImage(160)
+	detailsCont := container.NewVBox(container.NewCenter(cover), widget.NewSeparator(), performerCont, widget.NewSeparator(), albumCont, widget.NewSeparator(), albumArtistLabel, widget.NewSeparator(),
+				discLabel, widget.NewSeparator(), trackLabel, widget.NewSeparator(), yearLabel, widget.NewSeparator(), genreLabel, widget.NewSeparator(), composerLabel, widget.NewSeparator(),
+				commentLabel, widget.NewSeparator(), formatLabel, widget.NewSeparator(), audioLabel, widget.NewSeparator(), songEdit)
 	detailsCont.Hide()
 	detailsContainer := container.NewVBox(hbox, detailsCont)
 
@@ -262,31 +567,48 @@ func createListContainer(controller *controller.Controller, myWindow fyne.Window
 	contentIcons2 := container.NewVBox(contentIcons, iconStop)
 
 	list.OnSelected = func(id widget.ListItemID) {
-		songs, err := controller.GetSongs()
-		if err != nil {
-			dialog.ShowError(err, myWindow) 
+		if id >= len(songs) {
 			return
 		}
 		song := songs[id]
-		label.SetText(song.Title)
-		music.SetText(song.Title)
+		label.SetText(orUnknown(song.Title))
+		music.SetText(orUnknown(song.Title))
 		icon.SetResource(theme.MediaMusicIcon())
 		musicIcon.SetResource(theme.MediaMusicIcon())
-		performerLabel.SetText("Artist: " + song.PerformerName)
-		albumLabel.SetText("Album: " + song.AlbumName)
-		trackLabel.SetText("Track: " + fmt.Sprintf("%d", song.Track))
-		yearLabel.SetText("Year: " + fmt.Sprintf("%d", song.Year))
-		genreLabel.SetText("Genre: " + song.Genre)
+		performerLabel.SetText("Artist: " + orUnknown(controller.ArtistCredit(song)))
+		albumLabel.SetText("Album: " + orUnknown(song.AlbumName))
+		trackLabel.SetText("Track: " + numberOrUnknown(song.Track))
+		yearLabel.SetText("Year: " + numberOrUnknown(song.Year))
+		genreLabel.SetText("Genre: " + orUnknown(song.Genre))
+		formatLabel.SetText("Format: " + song.Format)
+		audioLabel.SetText("Audio: " + orUnknown(song.Audio().String()))
+		albumArtistLabel.SetText("Album artist: " + orUnknown(song.AlbumArtistName))
+		discLabel.SetText("Disc: " + fmt.Sprintf("%d", song.Disc))
+		composerLabel.SetText("Composer: " + orUnknown(song.Composer))
+		commentLabel.SetText("Comment: " + song.Comment)
+		setCover(cover, controller.CoverThumbnail(song))
 		detailsCont.Show()
 		songEdit.OnTapped = func() {
-			openEditSongWindow(myApp, controller, song.ID, updateList)
+			openEditSongWindow(myApp, controller, song, updateList)
 		}
 		albumEdit.OnTapped = func() {
-			openEditAlbumWindow(myApp, controller, song.AlbumID)
+			openEditAlbumWindow(myApp, controller, song.AlbumID, song.AlbumArtistName, updateList)
 		}
 		performerEdit.OnTapped = func() {
 			openEditPerformerWindow(myApp, controller, song.PerformerID)
 		}
+		// A song without an artist tag has no performer to edit.
+		if song.PerformerID == 0 {
+			performerEdit.Disable()
+		} else {
+			performerEdit.Enable()
+		}
+		// Nor does a song without an album tag have an album to edit.
+		if song.AlbumID == 0 {
+			albumEdit.Disable()
+		} else {
+			albumEdit.Enable()
+		}
 	}
 	list.OnUnselected = func(id widget.ListItemID) {
 		label.SetText("Select An Item From The List")
@@ -298,36 +620,46 @@ func createListContainer(controller *controller.Controller, myWindow fyne.Window
 }
 
 // createListContainerBySearch creates a container to display songs based on the search query.
-func createListContainerBySearch(controller *controller.Controller, myWindow fyne.Window, myApp fyne.App, search string) (*container.Split, *container.Split) {
+// The returned function loads the page of results described by the options.
+func createListContainerBySearch(controller *controller.Controller, myWindow fyne.Window, myApp fyne.App, search string, options *model.SearchOptions) (*container.Split, *container.Split, func()) {
 	var (
 		songEdit *widget.Button
 		albumEdit *widget.Button
 		performerEdit *widget.Button
 	)
 	data := make([]string, 0)
+	var songs []model.Song
 
 	list := widget.NewList(
 		func() int {
 			return len(data)
 		},
 		func() fyne.CanvasObject {
-			return container.NewHBox(widget.NewIcon(theme.MediaMusicIcon()), widget.NewLabel("Template Object"))
+			return container.NewHBox(newCoverImage(32), widget.NewLabel("Template Object"))
 		},
 		func(id widget.ListItemID, item fyne.CanvasObject) {
-			item.(*fyne.Container).Objects[1].(*widget.Label).SetText(data[id])
+			row := item.(*fyne.Container)
+			row.Objects[1].(*widget.Label).SetText(data[id])
+			thumbnail := ""
+			if id < len(songs) {
+				thumbnail = controller.CoverThumbnail(songs[id])
+			}
+			setCover(row.Objects[0].(*canvas.Image), thumbnail)
 		},
 	)
 	
 	updateList := func() {
-		songs, err := controller.GetSearchSongs(search)
+		found, err := controller.GetSearchSongs(search, *options)
 		if err == nil {
+			songs = found
 			data = data[:0]
 			for _, song := range songs {
-				data = append(data, song.Title)
+				data = append(data, songLabel(song))
 			}
 		} else {
-			data = append(data, "Error loading songs")
+			dialog.ShowError(err, myWindow)
 		}
+		list.UnselectAll()
 		list.Refresh()
 	}
 
@@ -345,8 +677,17 @@ func createListContainerBySearch(controller *controller.Controller, myWindow fyn
 	trackLabel := widget.NewLabel("Track: ")
 	yearLabel := widget.NewLabel("Year: ")
 	genreLabel := widget.NewLabel("Genre: ")
-	detailsCont := container.NewVBox(widget.NewSeparator(), performerCont, widget.NewSeparator(), albumCont, widget.NewSeparator(), 
-				trackLabel, widget.NewSeparator(), yearLabel, widget.NewSeparator(), genreLabel, widget.NewSeparator(), songEdit)
+	formatLabel := widget.NewLabel("Format: ")
+	audioLabel := widget.NewLabel("Audio: ")
+	albumArtistLabel := widget.NewLabel("Album artist: ")
+	discLabel := widget.NewLabel("Disc: ")
+	composerLabel := widget.NewLabel("Composer: ")
+	commentLabel := widget.NewLabel("Comment: ")
+	commentLabel.Wrapping = fyne.TextWrapWord
+	cover := newCoverImage(160)
+	detailsCont := container.NewVBox(container.NewCenter(cover), widget.NewSeparator(), performerCont, widget.NewSeparator(), albumCont, widget.NewSeparator(), albumArtistLabel, widget.NewSeparator(),
+				discLabel, widget.NewSeparator(), trackLabel, widget.NewSeparator(), yearLabel, widget.NewSeparator(), genreLabel, widget.NewSeparator(), composerLabel, widget.NewSeparator(),
+				commentLabel, widget.NewSeparator(), formatLabel, widget.NewSeparator(), audioLabel, widget.NewSeparator(), songEdit)
 	detailsCont.Hide()
 	detailsContainer := container.NewVBox(hbox, detailsCont)
 
@@ -366,43 +707,60 @@ func createListContainerBySearch(controller *controller.Controller, myWindow fyn
 	contentIcons2 := container.NewVBox(contentIcons, iconStop)
 
 	list.OnSelected = func(id widget.ListItemID) {
-		songs, err := controller.GetSearchSongs(search)
-		if err != nil {
-			dialog.ShowError(err, myWindow) 
+		if id >= len(songs) {
 			return
 		}
 		song := songs[id]
-		label.SetText(song.Title)
-		music.SetText(song.Title)
+		label.SetText(orUnknown(song.Title))
+		music.SetText(orUnknown(song.Title))
 		icon.SetResource(theme.MediaMusicIcon())
 		musicIcon.SetResource(theme.MediaMusicIcon())
-		performerLabel.SetText("Artist: " + song.PerformerName)
-		albumLabel.SetText("Album: " + song.AlbumName)
-		trackLabel.SetText("Track: " + fmt.Sprintf("%d", song.Track))
-		yearLabel.SetText("Year: " + fmt.Sprintf("%d", song.Year))
-		genreLabel.SetText("Genre: " + song.Genre)
+		performerLabel.SetText("Artist: " + orUnknown(controller.ArtistCredit(song)))
+		albumLabel.SetText("Album: " + orUnknown(song.AlbumName))
+		trackLabel.SetText("Track: " + numberOrUnknown(song.Track))
+		yearLabel.SetText("Year: " + numberOrUnknown(song.Year))
+		genreLabel.SetText("Genre: " + orUnknown(song.Genre))
+		formatLabel.SetText("Format: " + song.Format)
+		audioLabel.SetText("Audio: " + orUnknown(song.Audio().String()))
+		albumArtistLabel.SetText("Album artist: " + orUnknown(song.AlbumArtistName))
+		discLabel.SetText("Disc: " + fmt.Sprintf("%d", song.Disc))
+		composerLabel.SetText("Composer: " + orUnknown(song.Composer))
+		commentLabel.SetText("Comment: " + song.Comment)
+		setCover(cover, controller.CoverThumbnail(song))
 		detailsCont.Show()
 		songEdit.OnTapped = func() {
-			openEditSongWindow(myApp, controller, song.ID, updateList)
+			openEditSongWindow(myApp, controller, song, updateList)
 		}
 		albumEdit.OnTapped = func() {
-			openEditAlbumWindow(myApp, controller, song.AlbumID)
+			openEditAlbumWindow(myApp, controller, song.AlbumID, song.AlbumArtistName, updateList)
 		}
 		performerEdit.OnTapped = func() {
 			openEditPerformerWindow(myApp, controller, song.PerformerID)
 		}
+		// A song without an artist tag has no performer to edit.
+		if song.PerformerID == 0 {
+			performerEdit.Disable()
+		} else {
+			performerEdit.Enable()
+		}
+		// Nor does a song without an album tag have an album to edit.
+		if song.AlbumID == 0 {
+			albumEdit.Disable()
+		} else {
+			albumEdit.Enable()
+		}
 	}
 	list.OnUnselected = func(id widget.ListItemID) {
 		label.SetText("Select An Item From The List")
 		icon.SetResource(nil)
 	}
-	updateList()
 
-	return container.NewHSplit(list, container.NewCenter(detailsContainer)), container.NewHSplit(container.NewCenter(yourMusic), container.NewCenter(contentIcons2))
+	return container.NewHSplit(list, container.NewCenter(detailsContainer)), container.NewHSplit(container.NewCenter(yourMusic), container.NewCenter(contentIcons2)), updateList
 }
 
 // openEditSongWindow opens a window to edit song information.
-func openEditSongWindow(myApp fyne.App, controller *controller.Controller, id int64, updateList func()) {
+func openEditSongWindow(myApp fyne.App, controller *controller.Controller, song model.Song, updateList func()) {
+	id := song.ID
 	editS := myApp.NewWindow("Edit")
 	editS.SetIcon(theme.DocumentCreateIcon())
 	editS.Resize(fyne.NewSize(600, 500))
@@ -419,6 +777,20 @@ func openEditSongWindow(myApp fyne.App, controller *controller.Controller, id in
 	genre := widget.NewEntry()
 	genre.SetPlaceHolder("New Genre")
 	genre.Validator = validation.NewRegexp(`^[A-Za-z]+$`, "Genre can only contain letters.")
+	disc := widget.NewEntry()
+	disc.SetPlaceHolder("Disc number")
+	disc.SetText(fmt.Sprintf("%d", song.Disc))
+	disc.Validator = validation.NewRegexp(`^[0-9]+$`, "Disc can only contain numbers.")
+	composer := widget.NewEntry()
+	composer.SetPlaceHolder("Composers")
+	composer.SetText(song.Composer)
+	comment := widget.NewMultiLineEntry()
+	comment.SetPlaceHolder("Comment")
+	comment.SetText(song.Comment)
+	writeFile := widget.NewCheck("Write the tags to the file", nil)
+	if song.Format != "mp3" || song.Missing {
+		writeFile.Disable()
+	}
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
@@ -426,6 +798,10 @@ func openEditSongWindow(myApp fyne.App, controller *controller.Controller, id in
 			{Text: "Track", Widget: track, HintText: "Track number change."},
 			{Text: "Year", Widget: year, HintText: "Year change."},
 			{Text: "Genre", Widget: genre, HintText: "Genre change."},
+			{Text: "Disc", Widget: disc, HintText: "Disc number change."},
+			{Text: "Composer", Widget: composer, HintText: "Separate several composers with ';'."},
+			{Text: "Comment", Widget: comment, HintText: "Comment change."},
+			{Text: "File", Widget: writeFile, HintText: "Only MP3 files can be written."},
 		},
 		OnCancel: func() {
 			fmt.Println("Cancelled")
@@ -435,7 +811,15 @@ func openEditSongWindow(myApp fyne.App, controller *controller.Controller, id in
 			fmt.Println("Form submitted")
 			trackNum, _ := strconv.Atoi(track.Text)
 			yearNum, _ := strconv.Atoi(year.Text)
-			if err := controller.EditSong(id, title.Text, genre.Text, trackNum, yearNum); err != nil {
+			discNum, _ := strconv.Atoi(disc.Text)
+			err := controller.EditSong(id, title.Text, genre.Text, trackNum, yearNum)
+			if err == nil {
+				err = controller.EditSongCredits(id, discNum, composer.Text, comment.Text)
+			}
+			if err == nil && writeFile.Checked {
+				err = controller.WriteSongTags(id)
+			}
+			if err != nil {
 				dialog.ShowError(err, editS)
 			} else {
 				fyne.CurrentApp().SendNotification(&fyne.Notification{
@@ -460,7 +844,7 @@ func openEditSongWindow(myApp fyne.App, controller *controller.Controller, id in
 }
 
 // openEditAlbumWindow opens a window to edit album information.
-func openEditAlbumWindow(myApp fyne.App, controller *controller.Controller, id int64) {
+func openEditAlbumWindow(myApp fyne.App, controller *controller.Controller, id int64, albumArtist string, updateList func()) {
 	editA := myApp.NewWindow("Edit")
 	editA.SetIcon(theme.DocumentCreateIcon())
 	editA.Resize(fyne.NewSize(600, 500))
@@ -472,10 +856,17 @@ func openEditAlbumWindow(myApp fyne.App, controller *controller.Controller, id i
 	year.SetPlaceHolder("Year number")
 	year.Validator = validation.NewRegexp(`^[0-9]+$`, "Year can only contain numbers.")
 
+	artist := widget.NewEntry()
+	artist.SetPlaceHolder("Album artist")
+	artist.SetText(albumArtist)
+	writeFiles := widget.NewCheck("Write the tags to the files", nil)
+
 	form := &widget.Form{
 		Items: []*widget.FormItem{
 			{Text: "Name", Widget: name, HintText: "Name change."},
 			{Text: "Year", Widget: year, HintText: "Year change."},
+			{Text: "Album artist", Widget: artist, HintText: "Leave it empty for no album artist."},
+			{Text: "Files", Widget: writeFiles, HintText: "Only MP3 files are written."},
 		},
 		OnCancel: func() {
 			fmt.Println("Cancelled")
@@ -484,13 +875,21 @@ func openEditAlbumWindow(myApp fyne.App, controller *controller.Controller, id i
 		OnSubmit: func() {
 			fmt.Println("Form submitted")
 			yearNum, _ := strconv.Atoi(year.Text)
-			if err := controller.EditAlbum(id, name.Text, yearNum); err != nil {
+			err := controller.EditAlbum(id, name.Text, yearNum)
+			if err == nil {
+				err = controller.EditAlbumArtist(id, artist.Text)
+			}
+			if err == nil && writeFiles.Checked {
+				err = controller.WriteAlbumTags(id)
+			}
+			if err != nil {
 				dialog.ShowError(err, editA)
 			} else {
 				fyne.CurrentApp().SendNotification(&fyne.Notification{
 					Title:   "Music DB",
-					Content: "Modified Album: " + name.Text + ".\n Year: " + year.Text,
+					Content: "Modified Album: " + name.Text + ".\n Year: " + year.Text + ".\n Album artist: " + artist.Text,
 				})
+				updateList()
 			}
 			editA.Close()
 		},
@@ -555,8 +954,16 @@ func openEditPerformerWindow(myApp fyne.App, controller *controller.Controller,
 			noDef.Enable()
 		}
 	})
-	nameInG := widget.NewEntry()
-	nameInG.SetPlaceHolder("Group name")
+	var groupNames []string
+	groups, err := controller.GetGroups()
+	if err != nil {
+		dialog.ShowError(err, editP)
+	}
+	for _, group := range groups {
+		groupNames = append(groupNames, group.Name)
+	}
+	nameInG := widget.NewSelect(groupNames, nil)
+	nameInG.PlaceHolder = "Pick a group"
 	nameInG.Disable()
 	inGroup = widget.NewCheck("Put it in a group", func(b bool) {
 		if b {
@@ -609,13 +1016,40 @@ func openEditPerformerWindow(myApp fyne.App, controller *controller.Controller,
 		}
 	})
 
+	details, err := controller.GetPerformerDetails(id)
+	if err != nil {
+		dialog.ShowError(err, editP)
+	}
+	membership := widget.NewLabel("")
+	name.SetText(details.Name)
+	nameG.SetText(details.Name)
+	newName.SetText(details.Name)
+	if details.Person != nil {
+		name.SetText(details.Person.StageName)
+		realName.SetText(details.Person.RealName)
+		birth.SetText(details.Person.BirthDate)
+		death.SetText(details.Person.DeathDate)
+		var groups []string
+		for _, group := range details.Groups {
+			groups = append(groups, group.Name)
+		}
+		if len(groups) > 0 {
+			membership.SetText("Member of: " + strings.Join(groups, ", "))
+		}
+	}
+	if details.Group != nil {
+		nameG.SetText(details.Group.Name)
+		start.SetText(details.Group.StartDate)
+		end.SetText(details.Group.EndDate)
+	}
+
 	form := &widget.Form{
 		Items: []*widget.FormItem{
 			{Text: "Stage name", Widget: name, HintText: "Put a name."},
 			{Text: "Real name", Widget: realName, HintText: "Put a name."},
 			{Text: "Birth date", Widget: birth, HintText: "Put a birth date."},
 			{Text: "death date", Widget: death, HintText: "Put a death date. 0 if alive."},
-			{Text: "Group", Widget: nameInG, HintText: "Enter a name of an existing group."},
+			{Text: "Group", Widget: nameInG, HintText: "Pick the group to add the person to."},
 		},
 		OnCancel: func() {
 			fmt.Println("Cancelled")
@@ -623,15 +1057,21 @@ func openEditPerformerWindow(myApp fyne.App, controller *controller.Controller,
 		},
 		OnSubmit: func() {
 			fmt.Println("Form submitted")
-			if nameInG.Text != "" {
+			if i := nameInG.SelectedIndex(); i >= 0 {
 				err := controller.DefPerson(id, name.Text, realName.Text, birth.Text, death.Text)
-				err = controller.AddPersonToGroup(name.Text, realName.Text, birth.Text, death.Text, nameInG.Text)
+				var details model.PerformerDetails
+				if err == nil {
+					details, err = controller.GetPerformerDetails(id)
+				}
+				if err == nil {
+					err = controller.AddMember(details.Person.ID, groups[i].ID, "", "", "")
+				}
 				if err != nil {
 					dialog.ShowError(err, editP)
 				} else {
 					fyne.CurrentApp().SendNotification(&fyne.Notification{
 						Title:   "Music DB",
-						Content: "Modified Performer: " + name.Text + ".\n Real name: " + realName.Text + ".\n Birth date: " + birth.Text + ".\n Death date: " + death.Text + ".\n Add to group: " + nameInG.Text,
+						Content: "Modified Performer: " + name.Text + ".\n Real name: " + realName.Text + ".\n Birth date: " + birth.Text + ".\n Death date: " + death.Text + ".\n Add to group: " + nameInG.Selected,
 					})
 				}
 			} else {
@@ -649,6 +1089,7 @@ func openEditPerformerWindow(myApp fyne.App, controller *controller.Controller,
 	}
 	form.Append("Person", person)
 	form.Append("In a Group", inGroup)
+	form.Append("Groups", membership)
 
 	form2 := &widget.Form{
 		Items: []*widget.FormItem{
@@ -674,6 +1115,13 @@ func openEditPerformerWindow(myApp fyne.App, controller *controller.Controller,
 		},
 	}
 	form2.Append("Group", group)
+	members := widget.NewButtonWithIcon("Members", theme.AccountIcon(), func() {
+		openGroupWindow(myApp, controller, *details.Group)
+	})
+	if details.Group == nil {
+		members.Disable()
+	}
+	form2.Append("Members", members)
 
 	form3 := &widget.Form{
 		Items: []*widget.FormItem{
@@ -707,6 +1155,230 @@ func openEditPerformerWindow(myApp fyne.App, controller *controller.Controller,
 	editContent := container.New(layout.NewBorderLayout(center, nil, nil, nil),
 		center, container.NewHSplit(form, forms))
 
+	if details.Person != nil {
+		person.SetChecked(true)
+	} else if details.Group != nil {
+		group.SetChecked(true)
+	}
 	editP.SetContent(editContent)
 	editP.Show()
-}
\ No newline at end of file
+}
+
+// openGroupsWindow opens a window listing every group, where selecting one opens its details.
+func openGroupsWindow(myApp fyne.App, controller *controller.Controller) {
+	groupsW := myApp.NewWindow("Groups")
+	groupsW.SetIcon(theme.AccountIcon())
+	groupsW.Resize(fyne.NewSize(400, 500))
+
+	groups, err := controller.GetGroups()
+	if err != nil {
+		dialog.ShowError(err, groupsW)
+	}
+	list := widget.NewList(
+		func() int {
+			return len(groups)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Template Object")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(groups[id].Name)
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		openGroupWindow(myApp, controller, groups[id])
+		list.Unselect(id)
+	}
+	if len(groups) == 0 {
+		groupsW.SetContent(widget.NewLabel("There are no groups. Define a performer as a group first."))
+	} else {
+		groupsW.SetContent(list)
+	}
+	groupsW.Show()
+}
+
+// membershipLabel describes a member of a group as in "Name, guitar (1990 - 2000)".
+func membershipLabel(membership model.Membership) string {
+	label := membership.PersonName
+	if membership.Role != "" {
+		label += ", " + membership.Role
+	}
+	if membership.StartDate != "" || membership.EndDate != "" {
+		label += fmt.Sprintf(" (%s - %s)", membership.StartDate, membership.EndDate)
+	}
+	return label
+}
+
+// openGroupWindow opens a window with the details of a group, where its members are added and
+// removed picking them from the persons in the database.
+func openGroupWindow(myApp fyne.App, controller *controller.Controller, group model.Group) {
+	groupW := myApp.NewWindow("Group")
+	groupW.SetIcon(theme.AccountIcon())
+	groupW.Resize(fyne.NewSize(600, 500))
+
+	var members []model.Membership
+	var memberList *widget.List
+	updateMembers := func() {
+		found, err := controller.GetGroupMembers(group.ID)
+		if err != nil {
+			dialog.ShowError(err, groupW)
+			return
+		}
+		members = found
+		memberList.Refresh()
+	}
+	memberList = widget.NewList(
+		func() int {
+			return len(members)
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil, widget.NewButtonWithIcon("", theme.DeleteIcon(), nil), widget.NewLabel("Template Object"))
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			member := members[id]
+			row := item.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(membershipLabel(member))
+			row.Objects[1].(*widget.Button).OnTapped = func() {
+				if err := controller.RemoveMember(member.PersonID, member.GroupID); err != nil {
+					dialog.ShowError(err, groupW)
+				}
+				updateMembers()
+			}
+		},
+	)
+
+	persons, err := controller.GetPersons()
+	if err != nil {
+		dialog.ShowError(err, groupW)
+	}
+	var personNames []string
+	for _, person := range persons {
+		personNames = append(personNames, person.StageName)
+	}
+	person := widget.NewSelect(personNames, nil)
+	person.PlaceHolder = "Pick a person"
+	role := widget.NewEntry()
+	role.SetPlaceHolder("Role or instrument")
+	start := widget.NewEntry()
+	start.SetPlaceHolder("Joined")
+	end := widget.NewEntry()
+	end.SetPlaceHolder("Left")
+
+	form := &widget.Form{
+		Items: []*widget.FormItem{
+			{Text: "Person", Widget: person, HintText: "Only persons can be members."},
+			{Text: "Role", Widget: role, HintText: "Optional."},
+			{Text: "Joined", Widget: start, HintText: "Optional."},
+			{Text: "Left", Widget: end, HintText: "Optional. Adding a member again updates these."},
+		},
+		SubmitText: "Add member",
+		OnSubmit: func() {
+			if person.SelectedIndex() < 0 {
+				dialog.ShowInformation("Add member", "Pick a person first.", groupW)
+				return
+			}
+			personID := persons[person.SelectedIndex()].ID
+			if err := controller.AddMember(personID, group.ID, start.Text, end.Text, role.Text); err != nil {
+				dialog.ShowError(err, groupW)
+				return
+			}
+			person.ClearSelected()
+			role.SetText("")
+			start.SetText("")
+			end.SetText("")
+			updateMembers()
+		},
+	}
+
+	title := widget.NewLabelWithStyle(group.Name, fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+	dates := widget.NewLabelWithStyle(fmt.Sprintf("%s - %s", group.StartDate, group.EndDate), fyne.TextAlignCenter, fyne.TextStyle{Italic: true})
+	north := container.NewVBox(title, dates, widget.NewSeparator())
+	groupW.SetContent(container.NewBorder(north, form, nil, nil, memberList))
+	updateMembers()
+	groupW.Show()
+}
+
+// openMergeWindow opens a window with the performers and albums that are likely duplicates,
+// where each group is merged into the one picked to keep.
+func openMergeWindow(myApp fyne.App, controller *controller.Controller, updateList func()) {
+	mergeW := myApp.NewWindow("Merge duplicates")
+	mergeW.SetIcon(theme.ContentCopyIcon())
+	mergeW.Resize(fyne.NewSize(700, 500))
+
+	performers := container.NewVBox()
+	albums := container.NewVBox()
+	var reload func()
+	merged := func() {
+		reload()
+		updateList()
+	}
+	reload = func() {
+		found, err := controller.FindDuplicatePerformers()
+		if err != nil {
+			dialog.ShowError(err, mergeW)
+			return
+		}
+		fillDuplicates(performers, found, mergeW, controller.MergePerformers, merged)
+		found, err = controller.FindDuplicateAlbums()
+		if err != nil {
+			dialog.ShowError(err, mergeW)
+			return
+		}
+		fillDuplicates(albums, found, mergeW, controller.MergeAlbums, merged)
+	}
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Performers", container.NewVScroll(performers)),
+		container.NewTabItem("Albums", container.NewVScroll(albums)),
+	)
+	mergeW.SetContent(tabs)
+	reload()
+	mergeW.Show()
+}
+
+// fillDuplicates fills box with a card for each group of duplicates, where the one to keep is
+// picked and the others are merged into it with merge.
+func fillDuplicates(box *fyne.Container, groups []model.Duplicates, window fyne.Window, merge func(int64, []int64) error, merged func()) {
+	box.RemoveAll()
+	if len(groups) == 0 {
+		box.Add(widget.NewLabel("No duplicates found."))
+	}
+	for _, group := range groups {
+		candidates := group.Candidates
+		var labels []string
+		for _, candidate := range candidates {
+			label := fmt.Sprintf("#%d %s", candidate.ID, candidate.Name)
+			if candidate.Detail != "" {
+				label += " (" + candidate.Detail + ")"
+			}
+			labels = append(labels, fmt.Sprintf("%s, %d songs", label, candidate.Songs))
+		}
+		keep := widget.NewRadioGroup(labels, nil)
+		keep.Required = true
+		keep.SetSelected(labels[0])
+		mergeButton := widget.NewButtonWithIcon("Merge", theme.ContentCopyIcon(), func() {
+			var survivor model.MergeCandidate
+			var duplicateIDs []int64
+			for i, candidate := range candidates {
+				if labels[i] == keep.Selected {
+					survivor = candidate
+				} else {
+					duplicateIDs = append(duplicateIDs, candidate.ID)
+				}
+			}
+			message := fmt.Sprintf("Merge the other %d into '%s'? This cannot be undone.", len(duplicateIDs), survivor.Name)
+			dialog.ShowConfirm("Merge duplicates", message, func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := merge(survivor.ID, duplicateIDs); err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
+				merged()
+			}, window)
+		})
+		box.Add(widget.NewCard(candidates[0].Name, "Pick the one to keep.", container.NewVBox(keep, mergeButton)))
+	}
+	box.Refresh()
+}